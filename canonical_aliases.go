@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/url"
+)
+
+// resolveCanonical returns the canonical URL a document declares with <link rel="canonical">, resolved against the
+// document's base and canonicalised like any other URL. It returns "" if the page declares no usable canonical.
+func (sc *SiteCrawler) resolveCanonical(pageURL *url.URL, base *url.URL, doc *Document) string {
+	if doc.Canonical == "" {
+		return ""
+	}
+	resolved, err := ResolveAndCleanURL(base, doc.Canonical)
+	if err == nil {
+		resolved, err = sc.Canonicalizer.Canonicalize(resolved)
+	}
+	if err != nil {
+		sc.Logger.Warn("Ignoring invalid canonical URL %s on page %s: %v", doc.Canonical, pageURL.String(), err)
+		return ""
+	}
+	return resolved.String()
+}
+
+// claimCanonical records that pageURL declares canonical as its canonical URL and reports whether the page should be
+// processed. Pages are deduplicated by their canonical URL (or their own URL if they don't declare one), so only the
+// first page crawled for each canonical URL is handed to the post-processors.
+func (sc *SiteCrawler) claimCanonical(pageURL, canonical string) bool {
+	key := pageURL
+	if canonical != "" && canonical != pageURL {
+		sc.canonicalAliases.Store(pageURL, canonical)
+		key = canonical
+	}
+	_, loaded := sc.processedCanonicals.LoadOrStore(key, pageURL)
+	return !loaded
+}
+
+// CanonicalAliases returns every alias URL found so far, mapped to the canonical URL it declared.
+func (sc *SiteCrawler) CanonicalAliases() map[string]string {
+	aliases := make(map[string]string)
+	sc.canonicalAliases.Range(func(alias, canonical any) bool {
+		aliases[alias.(string)] = canonical.(string)
+		return true
+	})
+	return aliases
+}
+
+// restoreCanonicalAliases reloads the aliases from a checkpoint and claims the canonical URLs of the processed pages,
+// so a resumed crawl doesn't process a duplicate of a page it has already processed.
+func (sc *SiteCrawler) restoreCanonicalAliases(aliases map[string]string, processed []string) {
+	for alias, canonical := range aliases {
+		sc.canonicalAliases.Store(alias, canonical)
+	}
+	for _, pageURL := range processed {
+		key := pageURL
+		if canonical, ok := aliases[pageURL]; ok {
+			key = canonical
+		}
+		sc.processedCanonicals.LoadOrStore(key, pageURL)
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"golang.org/x/net/idna"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// TrailingSlash says what a Canonicalizer does with a trailing slash on a URL path.
+type TrailingSlash int
+
+const (
+	TrailingSlashKeep  TrailingSlash = iota // Leave paths as they are, /docs and /docs/ are different URLs
+	TrailingSlashStrip                      // Remove trailing slashes, so /docs/ becomes /docs
+)
+
+// DefaultTrackingParams are query parameters that only exist to track where a visitor came from. A trailing * matches
+// any parameter with that prefix.
+var DefaultTrackingParams = []string{"utm_*", "gclid", "dclid", "fbclid", "msclkid", "yclid", "mc_cid", "mc_eid", "_ga"}
+
+// Canonicalizer rewrites URLs into a canonical form, so that the different ways of writing the same URL are only
+// crawled once. The canonical form is used as the crawler's deduplication key and as the URL that is enqueued.
+//
+// Fragments are always removed and dot segments and repeated slashes in the path are always collapsed; everything else
+// is configurable.
+type Canonicalizer struct {
+	LowercaseHost     bool          // Lowercase the scheme and host
+	StripDefaultPort  bool          // Remove :80 from http URLs and :443 from https URLs
+	IDNA              bool          // Convert internationalised host names to their ASCII (punycode) form
+	NormalizeEncoding bool          // Decode needlessly percent-encoded characters and uppercase the remaining escapes
+	SortQuery         bool          // Sort query parameters by name, keeping the order of repeated parameters
+	StripQueryParams  []string      // Query parameters to remove, such as DefaultTrackingParams
+	TrailingSlash     TrailingSlash // What to do with trailing slashes on the path
+}
+
+// DefaultCanonicalizer returns the canonicalizer the crawler uses unless told otherwise. It strips tracking
+// parameters but leaves the order of the remaining parameters and trailing slashes alone, as some sites rely on them.
+func DefaultCanonicalizer() *Canonicalizer {
+	return &Canonicalizer{
+		LowercaseHost:     true,
+		StripDefaultPort:  true,
+		IDNA:              true,
+		NormalizeEncoding: true,
+		StripQueryParams:  DefaultTrackingParams,
+		TrailingSlash:     TrailingSlashKeep,
+	}
+}
+
+// Canonicalize returns the canonical form of an absolute URL. The given URL is not modified. A nil Canonicalizer
+// only strips the fragment and cleans the path.
+func (c *Canonicalizer) Canonicalize(u *url.URL) (*url.URL, error) {
+	canonical := *u
+	canonical.Fragment = ""
+	canonical.RawFragment = ""
+	if canonical.User != nil {
+		user := *canonical.User
+		canonical.User = &user
+	}
+	if c == nil {
+		canonical.Path = cleanPath(canonical.Path)
+		canonical.RawPath = ""
+		return &canonical, nil
+	}
+
+	if c.LowercaseHost {
+		canonical.Scheme = strings.ToLower(canonical.Scheme)
+	}
+	host, err := c.canonicalHost(&canonical)
+	if err != nil {
+		return nil, err
+	}
+	canonical.Host = host
+
+	escapedPath := canonical.EscapedPath()
+	if c.NormalizeEncoding {
+		escapedPath = normalizePercentEncoding(escapedPath)
+	}
+	escapedPath = cleanPath(escapedPath)
+	if c.TrailingSlash == TrailingSlashStrip && escapedPath != "/" {
+		escapedPath = strings.TrimSuffix(escapedPath, "/")
+	}
+	if escapedPath == "" && canonical.Host != "" {
+		escapedPath = "/"
+	}
+	if canonical.Path, err = url.PathUnescape(escapedPath); err != nil {
+		return nil, err
+	}
+	canonical.RawPath = escapedPath
+
+	canonical.RawQuery = c.canonicalQuery(canonical.RawQuery)
+	canonical.ForceQuery = false
+	return &canonical, nil
+}
+
+// CanonicalizeString parses and canonicalizes a URL.
+func (c *Canonicalizer) CanonicalizeString(rawURL string) (string, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	canonical, err := c.Canonicalize(parsed)
+	if err != nil {
+		return "", err
+	}
+	return canonical.String(), nil
+}
+
+// hostProfile converts hosts to their ASCII form like idna.Lookup, but without the STD3 rules that reject underscores,
+// which real hostnames use even though DNS names shouldn't.
+var hostProfile = idna.New(idna.MapForLookup(), idna.StrictDomainName(false), idna.BidiRule())
+
+// canonicalHost applies the host rules to a URL's host and optional port.
+func (c *Canonicalizer) canonicalHost(u *url.URL) (string, error) {
+	// Hostname strips the brackets from IPv6 literals whether or not there is a port
+	hostname, port, scheme := u.Hostname(), u.Port(), u.Scheme
+	if c.LowercaseHost {
+		hostname = strings.ToLower(hostname)
+	}
+	if c.IDNA && hostname != "" && net.ParseIP(hostname) == nil {
+		ascii, err := hostProfile.ToASCII(hostname)
+		if err != nil {
+			return "", err
+		}
+		hostname = ascii
+	}
+	if c.StripDefaultPort && ((scheme == "http" && port == "80") || (scheme == "https" && port == "443")) {
+		port = ""
+	}
+	if port == "" {
+		if strings.Contains(hostname, ":") {
+			// IPv6 literals keep their brackets
+			return "[" + hostname + "]", nil
+		}
+		return hostname, nil
+	}
+	return net.JoinHostPort(hostname, port), nil
+}
+
+// canonicalQuery applies the query rules to a raw query string. Parameters are kept in their original encoding so
+// that removing or reordering them can't change what the others mean.
+func (c *Canonicalizer) canonicalQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	var params []string
+	for _, param := range strings.Split(rawQuery, "&") {
+		if param == "" {
+			continue
+		}
+		if c.NormalizeEncoding {
+			param = normalizePercentEncoding(param)
+		}
+		if c.stripsParam(queryParamName(param)) {
+			continue
+		}
+		params = append(params, param)
+	}
+	if c.SortQuery {
+		slices.SortStableFunc(params, func(a, b string) int {
+			return strings.Compare(queryParamName(a), queryParamName(b))
+		})
+	}
+	return strings.Join(params, "&")
+}
+
+// stripsParam reports whether a query parameter matches one of StripQueryParams.
+func (c *Canonicalizer) stripsParam(name string) bool {
+	for _, pattern := range c.StripQueryParams {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// queryParamName returns the decoded name of a raw "name=value" query parameter.
+func queryParamName(param string) string {
+	name, _, _ := strings.Cut(param, "=")
+	if unescaped, err := url.QueryUnescape(name); err == nil {
+		return unescaped
+	}
+	return name
+}
+
+// normalizePercentEncoding decodes percent-escapes of unreserved characters (letters, digits, "-", ".", "_" and "~"),
+// which mean the same thing escaped or not, and uppercases the hex digits of every other escape.
+func normalizePercentEncoding(s string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' || i+2 >= len(s) || !isHex(s[i+1]) || !isHex(s[i+2]) {
+			b.WriteByte(s[i])
+			continue
+		}
+		decoded := unhex(s[i+1])<<4 | unhex(s[i+2])
+		if isUnreserved(decoded) {
+			b.WriteByte(decoded)
+		} else {
+			b.WriteString(strings.ToUpper(s[i : i+3]))
+		}
+		i += 2
+	}
+	return b.String()
+}
+
+func isHex(c byte) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
+
+func isUnreserved(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
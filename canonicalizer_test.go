@@ -0,0 +1,76 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/url"
+	"testing"
+)
+
+func TestCanonicalizer_Canonicalize(t *testing.T) {
+	everything := &Canonicalizer{
+		LowercaseHost:     true,
+		StripDefaultPort:  true,
+		IDNA:              true,
+		NormalizeEncoding: true,
+		SortQuery:         true,
+		StripQueryParams:  DefaultTrackingParams,
+		TrailingSlash:     TrailingSlashStrip,
+	}
+	tests := []struct {
+		name          string
+		canonicalizer *Canonicalizer
+		url           string
+		expected      string
+	}{
+		{name: "lowercases scheme and host", canonicalizer: DefaultCanonicalizer(), url: "HTTPS://Example.COM/Path", expected: "https://example.com/Path"},
+		{name: "strips default https port", canonicalizer: DefaultCanonicalizer(), url: "https://example.com:443/", expected: "https://example.com/"},
+		{name: "strips default http port", canonicalizer: DefaultCanonicalizer(), url: "http://example.com:80/", expected: "http://example.com/"},
+		{name: "keeps other ports", canonicalizer: DefaultCanonicalizer(), url: "https://example.com:8443/", expected: "https://example.com:8443/"},
+		{name: "keeps IPv6 hosts", canonicalizer: DefaultCanonicalizer(), url: "http://[::1]:80/", expected: "http://[::1]/"},
+		{name: "keeps IPv6 hosts without a port", canonicalizer: DefaultCanonicalizer(), url: "http://[::1]/x", expected: "http://[::1]/x"},
+		{name: "keeps IPv6 hosts with other ports", canonicalizer: DefaultCanonicalizer(), url: "http://[::1]:8080/", expected: "http://[::1]:8080/"},
+		{name: "converts IDNA hosts to punycode", canonicalizer: DefaultCanonicalizer(), url: "https://Bücher.example/", expected: "https://xn--bcher-kva.example/"},
+		{name: "keeps underscores in hosts", canonicalizer: DefaultCanonicalizer(), url: "https://My_Site.example.com/a", expected: "https://my_site.example.com/a"},
+		{name: "adds a path to bare hosts", canonicalizer: DefaultCanonicalizer(), url: "https://example.com", expected: "https://example.com/"},
+		{name: "strips fragment", canonicalizer: DefaultCanonicalizer(), url: "https://example.com/a#b", expected: "https://example.com/a"},
+		{name: "cleans path", canonicalizer: DefaultCanonicalizer(), url: "https://example.com/a//b/./c/../d", expected: "https://example.com/a/b/d"},
+		{name: "keeps trailing slash by default", canonicalizer: DefaultCanonicalizer(), url: "https://example.com/docs/", expected: "https://example.com/docs/"},
+		{name: "strips trailing slash", canonicalizer: everything, url: "https://example.com/docs/", expected: "https://example.com/docs"},
+		{name: "never strips the root slash", canonicalizer: everything, url: "https://example.com/", expected: "https://example.com/"},
+		{name: "decodes unreserved escapes", canonicalizer: DefaultCanonicalizer(), url: "https://example.com/%7Euser/%61bc", expected: "https://example.com/~user/abc"},
+		{name: "uppercases reserved escapes", canonicalizer: DefaultCanonicalizer(), url: "https://example.com/a%2fb%3f?q=%e2%82%ac", expected: "https://example.com/a%2Fb%3F?q=%E2%82%AC"},
+		{name: "strips tracking params", canonicalizer: DefaultCanonicalizer(), url: "https://example.com/?utm_source=x&id=1&gclid=y&UTM=z&fbclid=w", expected: "https://example.com/?id=1&UTM=z"},
+		{name: "removes empty query", canonicalizer: DefaultCanonicalizer(), url: "https://example.com/?utm_medium=email", expected: "https://example.com/"},
+		{name: "keeps query order by default", canonicalizer: DefaultCanonicalizer(), url: "https://example.com/?b=2&a=1", expected: "https://example.com/?b=2&a=1"},
+		{name: "sorts query keeping repeated order", canonicalizer: everything, url: "https://example.com/?b=2&a=3&a=1&&c", expected: "https://example.com/?a=3&a=1&b=2&c"},
+		{name: "nil only strips fragment and cleans path", canonicalizer: nil, url: "HTTPS://Example.com:443//a/?utm_source=x#frag", expected: "https://Example.com:443/a/?utm_source=x"},
+		{name: "nothing enabled", canonicalizer: &Canonicalizer{}, url: "https://Example.com:443/%7e/?b&a", expected: "https://Example.com:443/%7e/?b&a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			canonical, err := tt.canonicalizer.CanonicalizeString(tt.url)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, canonical)
+		})
+	}
+}
+
+func TestCanonicalizer_Canonicalize_DoesNotModifyItsInput(t *testing.T) {
+	original := "HTTPS://Example.com:443/a/../b?utm_source=x#frag"
+	parsed, err := DefaultCanonicalizer().CanonicalizeString(original)
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/b", parsed)
+
+	u, err := url.Parse(original)
+	require.NoError(t, err)
+	before := u.String()
+	_, err = DefaultCanonicalizer().Canonicalize(u)
+	require.NoError(t, err)
+	assert.Equal(t, before, u.String())
+}
+
+func TestCanonicalizer_Canonicalize_RejectsInvalidIDNA(t *testing.T) {
+	_, err := DefaultCanonicalizer().CanonicalizeString("https://xn--a.example/")
+	assert.Error(t, err)
+}
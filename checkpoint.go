@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// checkpointVersion is bumped whenever the checkpoint format changes incompatibly.
+const checkpointVersion = 1
+
+// Checkpoint is the state needed to resume a crawl: which pages have been processed, which are still waiting and the
+// stats so far.
+type Checkpoint struct {
+	Version   int                `json:"version"`
+	CreatedAt time.Time          `json:"createdAt"`
+	Processed []string           `json:"processed"`
+	Pending   []FrontierItem     `json:"pending"`
+	Stats     CrawlStatsSnapshot `json:"stats"`
+	Aliases   map[string]string  `json:"aliases,omitempty"`   // rel=canonical aliases, alias URL to canonical URL
+	PathPages map[string]int     `json:"pathPages,omitempty"` // Pages claimed from each CrawlLimits.PathBudgets prefix
+}
+
+// SaveCheckpoint writes a checkpoint to path. It writes to a temporary file first and renames it into place, so a
+// crash part way through never leaves a truncated checkpoint behind.
+func SaveCheckpoint(path string, checkpoint *Checkpoint) error {
+	return writeJSONFileAtomically(path, checkpoint)
+}
+
+// writeJSONFileAtomically encodes v as JSON into a temporary file next to path, syncs it and renames it into place.
+func writeJSONFileAtomically(path string, v any) error {
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if err := json.NewEncoder(file).Encode(v); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+// LoadCheckpoint reads a checkpoint written by SaveCheckpoint.
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var checkpoint Checkpoint
+	if err := json.NewDecoder(file).Decode(&checkpoint); err != nil {
+		return nil, err
+	}
+	if checkpoint.Version != checkpointVersion {
+		return nil, fmt.Errorf("unsupported checkpoint version %d in %s", checkpoint.Version, path)
+	}
+	return &checkpoint, nil
+}
+
+// Checkpoint writes the crawler's current state to CheckpointPath.
+func (sc *SiteCrawler) Checkpoint() error {
+	// The frontier is snapshotted before the processed set: a page is only acknowledged to the frontier after it is
+	// marked processed, and after its links have been pushed, so nothing can fall between the two snapshots.
+	pending, err := sc.Frontier.Snapshot()
+	if err != nil {
+		return err
+	}
+	checkpoint := &Checkpoint{
+		Version:   checkpointVersion,
+		CreatedAt: time.Now(),
+		Processed: []string{},
+		Pending:   pending,
+		Stats:     sc.Stats.Snapshot(),
+		Aliases:   sc.CanonicalAliases(),
+		PathPages: sc.budget.pathUsage(),
+	}
+	sc.processedPages.Range(func(key, _ any) bool {
+		checkpoint.Processed = append(checkpoint.Processed, key.(string))
+		return true
+	})
+	if err := SaveCheckpoint(sc.CheckpointPath, checkpoint); err != nil {
+		return err
+	}
+	// Keep the validators in step with the checkpoint, so a resumed crawl still knows what it already fetched
+	sc.saveValidators()
+	sc.Logger.Debug("Checkpoint written to %s: %d processed, %d pending", sc.CheckpointPath, len(checkpoint.Processed), len(checkpoint.Pending))
+	return nil
+}
+
+// RestoreCheckpoint loads a checkpoint into the crawler so that the next call to Crawl continues where the
+// checkpointed crawl left off, without refetching pages that were already processed.
+// It must be called before Crawl.
+func (sc *SiteCrawler) RestoreCheckpoint(path string) error {
+	checkpoint, err := LoadCheckpoint(path)
+	if err != nil {
+		return err
+	}
+
+	pending := make(map[string]struct{}, len(checkpoint.Pending))
+	for _, item := range checkpoint.Pending {
+		pending[item.URL] = struct{}{}
+	}
+	for _, pageURL := range checkpoint.Processed {
+		// A page can be in both sets if it finished while the checkpoint was being taken; crawl it again in case
+		// its links were pushed after the frontier snapshot.
+		if _, ok := pending[pageURL]; ok {
+			continue
+		}
+		sc.processedPages.Store(pageURL, struct{}{})
+		sc.crawledPages.Store(pageURL, struct{}{})
+	}
+	for _, item := range checkpoint.Pending {
+		if _, loaded := sc.crawledPages.LoadOrStore(item.URL, struct{}{}); loaded {
+			continue
+		}
+		sc.crawlWg.Add(1)
+		if err := sc.Frontier.Push(item); err != nil {
+			sc.crawlWg.Done()
+			return err
+		}
+	}
+	sc.restoreCanonicalAliases(checkpoint.Aliases, checkpoint.Processed)
+	sc.Stats.Restore(checkpoint.Stats)
+	sc.budget.restore(int(checkpoint.Stats.PagesCrawled), checkpoint.PathPages)
+	sc.Logger.Info("Restored checkpoint from %s: %d processed, %d pending", path, len(checkpoint.Processed), len(checkpoint.Pending))
+	return nil
+}
+
+// Pause stops workers from starting new pages. Pages already being crawled are allowed to finish.
+func (sc *SiteCrawler) Pause() {
+	sc.pauseMu.Lock()
+	defer sc.pauseMu.Unlock()
+	if sc.paused == nil {
+		sc.paused = make(chan struct{})
+		sc.Logger.Info("Crawl paused")
+	}
+}
+
+// Resume lets workers continue after Pause.
+func (sc *SiteCrawler) Resume() {
+	sc.pauseMu.Lock()
+	defer sc.pauseMu.Unlock()
+	if sc.paused != nil {
+		close(sc.paused)
+		sc.paused = nil
+		sc.Logger.Info("Crawl resumed")
+	}
+}
+
+// waitWhilePaused blocks while the crawler is paused, returning false if ctx is done or the crawl ends first.
+func (sc *SiteCrawler) waitWhilePaused(ctx context.Context) bool {
+	sc.pauseMu.Lock()
+	paused := sc.paused
+	sc.pauseMu.Unlock()
+	if paused == nil {
+		return true
+	}
+	select {
+	case <-ctx.Done():
+		return false
+	case <-sc.stopWorkers:
+		return false
+	case <-paused:
+		return true
+	}
+}
+
+// startCheckpointing writes a checkpoint every CheckpointInterval until stop is closed.
+func (sc *SiteCrawler) startCheckpointing(stop <-chan struct{}) {
+	if sc.CheckpointPath == "" || sc.CheckpointInterval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(sc.CheckpointInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if err := sc.Checkpoint(); err != nil {
+					sc.Logger.Error("Failed to write checkpoint: %v", err)
+				}
+			}
+		}
+	}()
+}
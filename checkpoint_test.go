@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSaveCheckpoint_RoundTrips(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "crawl.checkpoint")
+	checkpoint := &Checkpoint{
+		Version:   checkpointVersion,
+		CreatedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		Processed: []string{"https://example.com/", "https://example.com/a"},
+		Pending:   []FrontierItem{{URL: "https://example.com/b", Depth: 1, Sitemap: &UrlEntry{Priority: floatPtr(0.4)}}},
+		Stats: CrawlStatsSnapshot{
+			PagesEnqueued: 3,
+			PagesCrawled:  2,
+			Skipped:       map[SkipReason]int64{SkipRobots: 1},
+		},
+		Aliases:   map[string]string{"https://example.com/a?ref=1": "https://example.com/a"},
+		PathPages: map[string]int{"/news/": 2},
+	}
+
+	require.NoError(t, SaveCheckpoint(path, checkpoint))
+	loaded, err := LoadCheckpoint(path)
+	require.NoError(t, err)
+	assert.Equal(t, checkpoint, loaded)
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "no temporary files are left behind")
+}
+
+func TestLoadCheckpoint_RejectsUnknownVersion(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "crawl.checkpoint")
+	require.NoError(t, SaveCheckpoint(path, &Checkpoint{Version: 99}))
+
+	_, err := LoadCheckpoint(path)
+	assert.ErrorContains(t, err, "unsupported checkpoint version 99")
+}
+
+func TestLoadCheckpoint_MissingFile(t *testing.T) {
+	t.Parallel()
+	_, err := LoadCheckpoint(filepath.Join(t.TempDir(), "missing"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestSiteCrawler_RestoreCheckpoint_RestoresCanonicalAliases(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "crawl.checkpoint")
+	require.NoError(t, SaveCheckpoint(path, &Checkpoint{
+		Version:   checkpointVersion,
+		Processed: []string{"https://example.com/a?ref=1"},
+		Aliases:   map[string]string{"https://example.com/a?ref=1": "https://example.com/a"},
+	}))
+	crawler, err := NewSiteCrawler(context.Background(), url.URL{Scheme: "https", Host: "example.com"}, &StdoutLogger{}, 1000, "Crawler", 1, nil, &FakeFetcher{})
+	require.NoError(t, err)
+
+	require.NoError(t, crawler.RestoreCheckpoint(path))
+
+	assert.Equal(t, map[string]string{"https://example.com/a?ref=1": "https://example.com/a"}, crawler.CanonicalAliases())
+	assert.False(t, crawler.claimCanonical("https://example.com/a", ""), "the canonical was already processed via its alias")
+}
+
+func TestSiteCrawler_RestoreCheckpoint_RestoresPathBudgets(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "crawl.checkpoint")
+	require.NoError(t, SaveCheckpoint(path, &Checkpoint{
+		Version:   checkpointVersion,
+		Processed: []string{"https://example.com/news/a", "https://example.com/news/b"},
+		Stats:     CrawlStatsSnapshot{PagesCrawled: 2},
+		PathPages: map[string]int{"/news/": 2},
+	}))
+	crawler, err := NewSiteCrawler(context.Background(), url.URL{Scheme: "https", Host: "example.com"}, &StdoutLogger{}, 1000, "Crawler", 1, nil, &FakeFetcher{})
+	require.NoError(t, err)
+	crawler.Limits.PathBudgets = map[string]int{"/news/": 2}
+
+	require.NoError(t, crawler.RestoreCheckpoint(path))
+
+	reason, ok := crawler.budget.reserve(crawler.Limits, "/news/c", 0)
+	assert.False(t, ok, "the path budget was used up before the checkpoint")
+	assert.Equal(t, SkipPathBudget, reason)
+	_, ok = crawler.budget.reserve(crawler.Limits, "/about", 0)
+	assert.True(t, ok)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"maps"
+	"strings"
+	"sync"
+)
+
+// CrawlLimits bounds how much of a site is crawled. Zero values mean unlimited.
+//
+// MaxPages and PathBudgets count pages that were fetched successfully. A page claims its slot when a worker takes it
+// from the frontier, in priority order, and gives it back if the fetch fails, so URLs still waiting in the frontier
+// and failed fetches don't use up the budget.
+type CrawlLimits struct {
+	MaxDepth    int            // Maximum number of links followed from a seed
+	MaxPages    int            // Maximum number of pages fetched
+	MaxBytes    int64          // Maximum number of bytes downloaded, across all fetches
+	PathBudgets map[string]int // Maximum number of pages fetched under each path prefix, e.g. {"/news/": 500}
+}
+
+// crawlBudget tracks usage against CrawlLimits. It is safe for concurrent use.
+type crawlBudget struct {
+	mu        sync.Mutex
+	pages     int
+	pathPages map[string]int
+}
+
+func newCrawlBudget() *crawlBudget {
+	return &crawlBudget{pathPages: make(map[string]int)}
+}
+
+// exceedsDepth reports whether depth is beyond MaxDepth.
+func (l CrawlLimits) exceedsDepth(depth int) bool {
+	return l.MaxDepth > 0 && depth > l.MaxDepth
+}
+
+// reserve claims a page from the budget for a URL with the given path, returning the reason it was refused if there
+// is no budget left.
+func (b *crawlBudget) reserve(limits CrawlLimits, path string, downloaded int64) (SkipReason, bool) {
+	if limits.bytesExhausted(downloaded) {
+		return SkipMaxBytes, false
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if limits.MaxPages > 0 && b.pages >= limits.MaxPages {
+		return SkipMaxPages, false
+	}
+	prefix, hasBudget := longestPrefix(limits.PathBudgets, path)
+	if hasBudget && b.pathPages[prefix] >= limits.PathBudgets[prefix] {
+		return SkipPathBudget, false
+	}
+
+	b.pages++
+	if hasBudget {
+		b.pathPages[prefix]++
+	}
+	return "", true
+}
+
+// release gives back a page claimed by reserve, e.g. because fetching it failed.
+func (b *crawlBudget) release(limits CrawlLimits, path string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pages--
+	if prefix, hasBudget := longestPrefix(limits.PathBudgets, path); hasBudget {
+		b.pathPages[prefix]--
+	}
+}
+
+// bytesExhausted reports whether downloaded has used up the byte budget.
+func (l CrawlLimits) bytesExhausted(downloaded int64) bool {
+	return l.MaxBytes > 0 && downloaded >= l.MaxBytes
+}
+
+// pathUsage returns the number of pages claimed under each path budget prefix, for checkpointing.
+func (b *crawlBudget) pathUsage() map[string]int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return maps.Clone(b.pathPages)
+}
+
+// restore sets the number of pages already claimed, in total and per path prefix, e.g. when resuming from a
+// checkpoint.
+func (b *crawlBudget) restore(pages int, pathPages map[string]int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pages = pages
+	b.pathPages = make(map[string]int, len(pathPages))
+	maps.Copy(b.pathPages, pathPages)
+}
+
+// longestPrefix finds the longest key of budgets that path starts with.
+func longestPrefix(budgets map[string]int, path string) (string, bool) {
+	best, found := "", false
+	for prefix := range budgets {
+		if strings.HasPrefix(path, prefix) && (!found || len(prefix) > len(best)) {
+			best, found = prefix, true
+		}
+	}
+	return best, found
+}
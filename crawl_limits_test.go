@@ -0,0 +1,74 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCrawlLimits_ExceedsDepth(t *testing.T) {
+	t.Parallel()
+	assert.False(t, CrawlLimits{}.exceedsDepth(100), "zero means unlimited")
+	assert.False(t, CrawlLimits{MaxDepth: 2}.exceedsDepth(2))
+	assert.True(t, CrawlLimits{MaxDepth: 2}.exceedsDepth(3))
+}
+
+func TestCrawlBudget_EnforcesMaxPages(t *testing.T) {
+	t.Parallel()
+	budget := newCrawlBudget()
+	limits := CrawlLimits{MaxPages: 2}
+
+	_, ok := budget.reserve(limits, "/a", 0)
+	assert.True(t, ok)
+	_, ok = budget.reserve(limits, "/b", 0)
+	assert.True(t, ok)
+	reason, ok := budget.reserve(limits, "/c", 0)
+	assert.False(t, ok)
+	assert.Equal(t, SkipMaxPages, reason)
+}
+
+func TestCrawlBudget_ReleaseGivesThePageBack(t *testing.T) {
+	t.Parallel()
+	budget := newCrawlBudget()
+	limits := CrawlLimits{MaxPages: 1, PathBudgets: map[string]int{"/news/": 1}}
+
+	_, ok := budget.reserve(limits, "/news/a", 0)
+	assert.True(t, ok)
+	budget.release(limits, "/news/a")
+	_, ok = budget.reserve(limits, "/news/b", 0)
+	assert.True(t, ok, "the failed page's slot can be used by another")
+	assert.Equal(t, map[string]int{"/news/": 1}, budget.pathUsage())
+}
+
+func TestCrawlBudget_EnforcesMaxBytes(t *testing.T) {
+	t.Parallel()
+	budget := newCrawlBudget()
+	limits := CrawlLimits{MaxBytes: 1000}
+
+	_, ok := budget.reserve(limits, "/a", 999)
+	assert.True(t, ok)
+	reason, ok := budget.reserve(limits, "/b", 1000)
+	assert.False(t, ok)
+	assert.Equal(t, SkipMaxBytes, reason)
+}
+
+func TestCrawlBudget_EnforcesLongestMatchingPathBudget(t *testing.T) {
+	t.Parallel()
+	budget := newCrawlBudget()
+	limits := CrawlLimits{PathBudgets: map[string]int{"/news/": 2, "/news/sport/": 1}}
+
+	_, ok := budget.reserve(limits, "/news/sport/football", 0)
+	assert.True(t, ok)
+	reason, ok := budget.reserve(limits, "/news/sport/cricket", 0)
+	assert.False(t, ok)
+	assert.Equal(t, SkipPathBudget, reason)
+
+	_, ok = budget.reserve(limits, "/news/politics", 0)
+	assert.True(t, ok)
+	_, ok = budget.reserve(limits, "/news/weather", 0)
+	assert.True(t, ok)
+	_, ok = budget.reserve(limits, "/news/business", 0)
+	assert.False(t, ok)
+
+	_, ok = budget.reserve(limits, "/about", 0)
+	assert.True(t, ok, "paths without a budget are unlimited")
+}
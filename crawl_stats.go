@@ -0,0 +1,135 @@
+package main
+
+import (
+	"maps"
+	"sync"
+)
+
+// SkipReason explains why a discovered URL was not crawled.
+type SkipReason string
+
+const (
+	SkipFiltered   SkipReason = "filtered" // Rejected by the URL filter, see URLFilter.Rejections for the rule
+	SkipRobots     SkipReason = "robots"
+	SkipOutOfScope SkipReason = "out_of_scope"
+	SkipMaxDepth   SkipReason = "max_depth"
+	SkipMaxPages   SkipReason = "max_pages"
+	SkipMaxBytes   SkipReason = "max_bytes"
+	SkipPathBudget SkipReason = "path_budget"
+	SkipLinkPolicy SkipReason = "link_policy"
+	SkipNoFollow   SkipReason = "nofollow"
+	SkipCanonical  SkipReason = "duplicate_canonical" // Crawled but not processed, its canonical was already processed
+)
+
+// CrawlStatsSnapshot is a point-in-time copy of a crawl's statistics.
+type CrawlStatsSnapshot struct {
+	PagesEnqueued   int64                `json:"pagesEnqueued"`
+	PagesCrawled    int64                `json:"pagesCrawled"`
+	BytesDownloaded int64                `json:"bytesDownloaded"`
+	Skipped         map[SkipReason]int64 `json:"skipped"`
+	// Hosts breaks the statistics down by host, for stats that have per-host children
+	Hosts map[string]CrawlStatsSnapshot `json:"hosts,omitempty"`
+}
+
+// CrawlStats counts what happened during a crawl. It is safe for concurrent use.
+//
+// Statistics can be broken down by host with ForHost: anything recorded on a host's stats is also counted in the
+// stats it came from.
+type CrawlStats struct {
+	mu       sync.Mutex
+	snapshot CrawlStatsSnapshot
+	parent   *CrawlStats
+	hosts    map[string]*CrawlStats
+}
+
+// NewCrawlStats creates an empty CrawlStats.
+func NewCrawlStats() *CrawlStats {
+	return &CrawlStats{snapshot: CrawlStatsSnapshot{Skipped: make(map[SkipReason]int64)}}
+}
+
+// ForHost returns the statistics for a single host, creating them if needed.
+func (s *CrawlStats) ForHost(host string) *CrawlStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.hosts == nil {
+		s.hosts = make(map[string]*CrawlStats)
+	}
+	stats, ok := s.hosts[host]
+	if !ok {
+		stats = NewCrawlStats()
+		stats.parent = s
+		s.hosts[host] = stats
+	}
+	return stats
+}
+
+// RecordEnqueued counts a URL added to the frontier.
+func (s *CrawlStats) RecordEnqueued() {
+	s.record(func(snapshot *CrawlStatsSnapshot) { snapshot.PagesEnqueued++ })
+}
+
+// RecordCrawled counts a page that was fetched successfully.
+func (s *CrawlStats) RecordCrawled() {
+	s.record(func(snapshot *CrawlStatsSnapshot) { snapshot.PagesCrawled++ })
+}
+
+// RecordBytes counts bytes downloaded by any fetch, including robots.txt and sitemaps.
+func (s *CrawlStats) RecordBytes(n int64) {
+	s.record(func(snapshot *CrawlStatsSnapshot) { snapshot.BytesDownloaded += n })
+}
+
+// BytesDownloaded returns the number of bytes downloaded so far.
+func (s *CrawlStats) BytesDownloaded() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.snapshot.BytesDownloaded
+}
+
+// RecordSkip counts a URL that was not crawled, and why.
+func (s *CrawlStats) RecordSkip(reason SkipReason) {
+	s.record(func(snapshot *CrawlStatsSnapshot) { snapshot.Skipped[reason]++ })
+}
+
+// record applies an update to these statistics and every parent they roll up into.
+func (s *CrawlStats) record(update func(snapshot *CrawlStatsSnapshot)) {
+	for stats := s; stats != nil; stats = stats.parent {
+		stats.mu.Lock()
+		update(&stats.snapshot)
+		stats.mu.Unlock()
+	}
+}
+
+// Restore replaces the current statistics, including any per-host statistics, with a snapshot, e.g. one loaded from
+// a checkpoint.
+func (s *CrawlStats) Restore(snapshot CrawlStatsSnapshot) {
+	s.mu.Lock()
+	s.snapshot = snapshot
+	s.snapshot.Skipped = maps.Clone(snapshot.Skipped)
+	if s.snapshot.Skipped == nil {
+		s.snapshot.Skipped = make(map[SkipReason]int64)
+	}
+	s.snapshot.Hosts = nil
+	s.hosts = nil
+	s.mu.Unlock()
+
+	for host, hostSnapshot := range snapshot.Hosts {
+		s.ForHost(host).Restore(hostSnapshot)
+	}
+}
+
+// Snapshot returns a copy of the current statistics, including any per-host statistics.
+func (s *CrawlStats) Snapshot() CrawlStatsSnapshot {
+	s.mu.Lock()
+	snapshot := s.snapshot
+	snapshot.Skipped = maps.Clone(s.snapshot.Skipped)
+	hosts := maps.Clone(s.hosts)
+	s.mu.Unlock()
+
+	if len(hosts) > 0 {
+		snapshot.Hosts = make(map[string]CrawlStatsSnapshot, len(hosts))
+		for host, stats := range hosts {
+			snapshot.Hosts[host] = stats.Snapshot()
+		}
+	}
+	return snapshot
+}
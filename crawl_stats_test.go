@@ -0,0 +1,74 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+)
+
+func TestCrawlStats_RecordsConcurrently(t *testing.T) {
+	t.Parallel()
+	stats := NewCrawlStats()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stats.RecordEnqueued()
+			stats.RecordCrawled()
+			stats.RecordBytes(10)
+			stats.RecordSkip(SkipRobots)
+		}()
+	}
+	wg.Wait()
+
+	snapshot := stats.Snapshot()
+	assert.Equal(t, int64(50), snapshot.PagesEnqueued)
+	assert.Equal(t, int64(50), snapshot.PagesCrawled)
+	assert.Equal(t, int64(500), snapshot.BytesDownloaded)
+	assert.Equal(t, int64(500), stats.BytesDownloaded())
+	assert.Equal(t, map[SkipReason]int64{SkipRobots: 50}, snapshot.Skipped)
+}
+
+func TestCrawlStats_SnapshotIsACopy(t *testing.T) {
+	t.Parallel()
+	stats := NewCrawlStats()
+	stats.RecordSkip(SkipMaxDepth)
+
+	snapshot := stats.Snapshot()
+	stats.RecordSkip(SkipMaxDepth)
+	assert.Equal(t, int64(1), snapshot.Skipped[SkipMaxDepth])
+}
+
+func TestCrawlStats_ForHostRollsUpIntoTotals(t *testing.T) {
+	t.Parallel()
+	stats := NewCrawlStats()
+	stats.ForHost("a.example").RecordCrawled()
+	stats.ForHost("a.example").RecordBytes(10)
+	stats.ForHost("b.example").RecordCrawled()
+	stats.ForHost("b.example").RecordSkip(SkipRobots)
+
+	snapshot := stats.Snapshot()
+	assert.Equal(t, int64(2), snapshot.PagesCrawled)
+	assert.Equal(t, int64(10), snapshot.BytesDownloaded)
+	assert.Equal(t, map[SkipReason]int64{SkipRobots: 1}, snapshot.Skipped)
+	assert.Equal(t, map[string]CrawlStatsSnapshot{
+		"a.example": {PagesCrawled: 1, BytesDownloaded: 10, Skipped: map[SkipReason]int64{}},
+		"b.example": {PagesCrawled: 1, Skipped: map[SkipReason]int64{SkipRobots: 1}},
+	}, snapshot.Hosts)
+}
+
+func TestCrawlStats_RestoresHosts(t *testing.T) {
+	t.Parallel()
+	stats := NewCrawlStats()
+	stats.ForHost("a.example").RecordEnqueued()
+
+	restored := NewCrawlStats()
+	restored.Restore(stats.Snapshot())
+	restored.ForHost("a.example").RecordEnqueued()
+
+	snapshot := restored.Snapshot()
+	assert.Equal(t, int64(2), snapshot.PagesEnqueued)
+	assert.Equal(t, int64(2), snapshot.Hosts["a.example"].PagesEnqueued)
+}
@@ -1,32 +1,333 @@
 package main
 
 import (
+	"github.com/samber/lo"
 	"golang.org/x/net/html"
+	"net/url"
 	"strings"
 )
 
+// LinkKind is the kind of element a link was found on.
+type LinkKind string
+
+const (
+	LinkAnchor     LinkKind = "anchor"     // <a href>
+	LinkArea       LinkKind = "area"       // <area href>
+	LinkIframe     LinkKind = "iframe"     // <iframe src>
+	LinkFrame      LinkKind = "frame"      // <frame src>
+	LinkAlternate  LinkKind = "alternate"  // <link rel="alternate" href>
+	LinkForm       LinkKind = "form"       // <form action>, GET forms only
+	LinkRefresh    LinkKind = "refresh"    // <meta http-equiv="refresh" content="0; url=...">
+	LinkImage      LinkKind = "image"      // <img src>, and every candidate in <img srcset> and <source srcset>
+	LinkScript     LinkKind = "script"     // <script src>
+	LinkStylesheet LinkKind = "stylesheet" // <link rel="stylesheet" href>
+)
+
+// IsPage reports whether links of this kind point at pages worth crawling, rather than at assets.
+func (k LinkKind) IsPage() bool {
+	switch k {
+	case LinkImage, LinkScript, LinkStylesheet:
+		return false
+	default:
+		return true
+	}
+}
+
+// LinkSection is the part of the page layout a link sits in.
+type LinkSection string
+
+const (
+	SectionNone   LinkSection = ""
+	SectionNav    LinkSection = "nav"
+	SectionHeader LinkSection = "header"
+	SectionFooter LinkSection = "footer"
+	SectionMain   LinkSection = "main"
+	SectionAside  LinkSection = "aside"
+)
+
+// sectionRoles maps ARIA landmark roles onto the sections of the equivalent HTML elements.
+var sectionRoles = map[string]LinkSection{
+	"navigation":    SectionNav,
+	"banner":        SectionHeader,
+	"contentinfo":   SectionFooter,
+	"main":          SectionMain,
+	"complementary": SectionAside,
+}
+
+// Link is a URL found in a document, as written in the document (it may be relative), along with its context.
+type Link struct {
+	URL      string
+	Kind     LinkKind
+	Text     string      // Anchor text with whitespace collapsed, or the alt text of an <area> or linked <img>
+	Title    string      // title attribute
+	Rel      []string    // Lower-cased rel values, e.g. nofollow, ugc, sponsored, noopener
+	Hreflang string      // hreflang attribute
+	Type     string      // Lower-cased type attribute, e.g. application/rss+xml on a feed's <link rel="alternate">
+	Section  LinkSection // Innermost nav, header, footer, main or aside element (or landmark role) containing the link
+	Position int         // Index of the link among all links in the document, in document order
+}
+
+// HasRel reports whether the link has the given rel value.
+func (l Link) HasRel(value string) bool {
+	return lo.Contains(l.Rel, strings.ToLower(value))
+}
+
+// feedTypes are the media types of the feed formats ParseFeed understands.
+var feedTypes = []string{"application/rss+xml", "application/atom+xml", "application/rdf+xml"}
+
+// IsFeed reports whether the link is a <link rel="alternate"> to an RSS or Atom feed.
+func (l Link) IsFeed() bool {
+	return l.Kind == LinkAlternate && lo.Contains(feedTypes, l.Type)
+}
+
+// Document is what we extract from a page's HTML.
+type Document struct {
+	Base      string    // href of the first <base> element, if there is one
+	Canonical string    // href of the first <link rel="canonical">, if there is one
+	Links     []Link    // In document order
+	MetaTags  []MetaTag // <meta name content> tags, in document order
+}
+
+// MetaTag is a <meta> tag with a name, such as <meta name="robots" content="noindex">.
+type MetaTag struct {
+	Name    string // Lower-cased
+	Content string
+}
+
+// ResolveBase returns the URL that relative links in the document are resolved against: pageURL (the URL the page was
+// served from, after redirects) overridden by the document's <base href>, if it has a usable one.
+func (d *Document) ResolveBase(pageURL *url.URL) *url.URL {
+	if d.Base == "" {
+		return pageURL
+	}
+	base, err := url.Parse(strings.TrimSpace(d.Base))
+	if err != nil {
+		return pageURL
+	}
+	base = pageURL.ResolveReference(base)
+	if base.Scheme != "http" && base.Scheme != "https" {
+		// Browsers ignore data: and javascript: bases, and so do we
+		return pageURL
+	}
+	return base
+}
+
+// PageLinks returns the links that point at pages.
+func (d *Document) PageLinks() []Link {
+	return lo.Filter(d.Links, func(link Link, _ int) bool { return link.Kind.IsPage() })
+}
+
+// FeedLinks returns the links to the page's RSS and Atom feeds.
+func (d *Document) FeedLinks() []Link {
+	return lo.Filter(d.Links, func(link Link, _ int) bool { return link.IsFeed() })
+}
+
+// AssetLinks returns the links that point at images, scripts and stylesheets.
+func (d *Document) AssetLinks() []Link {
+	return lo.Filter(d.Links, func(link Link, _ int) bool { return !link.Kind.IsPage() })
+}
+
+// ParseDocument parses HTML content and extracts every resource-bearing link from it, tagged by kind and with its
+// anchor text, attributes and position, along with the document's <base href>, canonical URL and named meta tags.
+func ParseDocument(htmlContent string) (*Document, error) {
+	root, err := html.Parse(strings.NewReader(htmlContent))
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &Document{}
+	var f func(n *html.Node, section LinkSection)
+	f = func(n *html.Node, section LinkSection) {
+		if n.Type == html.ElementNode {
+			if n.Data == "base" && doc.Base == "" {
+				doc.Base, _ = attr(n, "href")
+			}
+			if n.Data == "link" && doc.Canonical == "" && lo.Contains(relValues(n), "canonical") {
+				doc.Canonical, _ = attr(n, "href")
+			}
+			if name, ok := attr(n, "name"); ok && n.Data == "meta" {
+				content, _ := attr(n, "content")
+				doc.MetaTags = append(doc.MetaTags, MetaTag{Name: strings.ToLower(strings.TrimSpace(name)), Content: content})
+			}
+			section = elementSection(n, section)
+			for _, link := range elementLinks(n) {
+				link.Title, _ = attr(n, "title")
+				link.Rel = relValues(n)
+				link.Hreflang, _ = attr(n, "hreflang")
+				linkType, _ := attr(n, "type")
+				link.Type = strings.ToLower(strings.TrimSpace(linkType))
+				link.Section = section
+				link.Position = len(doc.Links)
+				switch n.Data {
+				case "a":
+					link.Text = linkText(n)
+				case "area":
+					link.Text, _ = attr(n, "alt")
+				}
+				doc.Links = append(doc.Links, link)
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			f(c, section)
+		}
+	}
+	f(root, SectionNone)
+
+	return doc, nil
+}
+
 // ExtractLinks takes an HTML content as a string and returns a slice of links (href attributes of <a> tags).
 func ExtractLinks(htmlContent string) ([]string, error) {
-	doc, err := html.Parse(strings.NewReader(htmlContent))
+	doc, err := ParseDocument(htmlContent)
 	if err != nil {
 		return nil, err
 	}
+	return lo.FilterMap(doc.Links, func(link Link, _ int) (string, bool) {
+		return link.URL, link.Kind == LinkAnchor
+	}), nil
+}
+
+// elementLinks returns the links carried by a single element.
+func elementLinks(n *html.Node) []Link {
+	switch n.Data {
+	case "a":
+		return attrLink(n, "href", LinkAnchor)
+	case "area":
+		return attrLink(n, "href", LinkArea)
+	case "iframe":
+		return attrLink(n, "src", LinkIframe)
+	case "frame":
+		return attrLink(n, "src", LinkFrame)
+	case "script":
+		return attrLink(n, "src", LinkScript)
+	case "img":
+		return append(attrLink(n, "src", LinkImage), srcsetLinks(n)...)
+	case "source":
+		return srcsetLinks(n)
+	case "link":
+		rel := relValues(n)
+		switch {
+		case lo.Contains(rel, "stylesheet"):
+			return attrLink(n, "href", LinkStylesheet)
+		case lo.Contains(rel, "alternate"):
+			return attrLink(n, "href", LinkAlternate)
+		}
+	case "form":
+		// The crawler only makes GET requests, so following a POST form's action would fetch the wrong thing
+		if method, _ := attr(n, "method"); method == "" || strings.EqualFold(method, "get") {
+			return attrLink(n, "action", LinkForm)
+		}
+	case "meta":
+		if equiv, _ := attr(n, "http-equiv"); strings.EqualFold(equiv, "refresh") {
+			content, _ := attr(n, "content")
+			if target, ok := parseRefreshURL(content); ok {
+				return []Link{{URL: target, Kind: LinkRefresh}}
+			}
+		}
+	}
+	return nil
+}
+
+// elementSection returns the section that n and its children sit in, given the section of its parent.
+func elementSection(n *html.Node, parent LinkSection) LinkSection {
+	switch n.Data {
+	case "nav":
+		return SectionNav
+	case "header":
+		return SectionHeader
+	case "footer":
+		return SectionFooter
+	case "main":
+		return SectionMain
+	case "aside":
+		return SectionAside
+	}
+	if role, ok := attr(n, "role"); ok {
+		if section, ok := sectionRoles[strings.ToLower(strings.TrimSpace(role))]; ok {
+			return section
+		}
+	}
+	return parent
+}
 
-	var links []string
+// linkText returns the text inside an element with whitespace collapsed, using the alt text of any images.
+func linkText(n *html.Node) string {
+	var text strings.Builder
 	var f func(*html.Node)
 	f = func(n *html.Node) {
-		if n.Type == html.ElementNode && n.Data == "a" {
-			for _, attr := range n.Attr {
-				if attr.Key == "href" {
-					links = append(links, attr.Val)
-				}
-			}
+		switch {
+		case n.Type == html.TextNode:
+			text.WriteString(n.Data)
+		case n.Type == html.ElementNode && n.Data == "img":
+			alt, _ := attr(n, "alt")
+			text.WriteString(" " + alt + " ")
 		}
 		for c := n.FirstChild; c != nil; c = c.NextSibling {
 			f(c)
 		}
 	}
-	f(doc)
+	f(n)
+	return strings.Join(strings.Fields(text.String()), " ")
+}
 
-	return links, nil
+// attr returns the value of an element's attribute.
+func attr(n *html.Node, key string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+// attrLink returns a link from the given attribute, if the element has it.
+func attrLink(n *html.Node, key string, kind LinkKind) []Link {
+	value, ok := attr(n, key)
+	if !ok {
+		return nil
+	}
+	return []Link{{URL: value, Kind: kind}}
+}
+
+// relValues returns the lower-cased, space separated values of an element's rel attribute.
+func relValues(n *html.Node) []string {
+	rel, _ := attr(n, "rel")
+	if strings.TrimSpace(rel) == "" {
+		return nil
+	}
+	return strings.Fields(strings.ToLower(rel))
+}
+
+// srcsetLinks returns an image link for every candidate in an element's srcset, e.g. "small.jpg 1x, large.jpg 2x".
+func srcsetLinks(n *html.Node) []Link {
+	srcset, ok := attr(n, "srcset")
+	if !ok {
+		return nil
+	}
+	var links []Link
+	for _, candidate := range strings.Split(srcset, ",") {
+		if fields := strings.Fields(candidate); len(fields) > 0 {
+			links = append(links, Link{URL: fields[0], Kind: LinkImage})
+		}
+	}
+	return links
+}
+
+// parseRefreshURL extracts the URL from a meta refresh content value such as `5; url='/next'`.
+func parseRefreshURL(content string) (string, bool) {
+	_, target, ok := strings.Cut(content, ";")
+	if !ok {
+		return "", false
+	}
+	target = strings.TrimSpace(target)
+	if len(target) < 4 || !strings.EqualFold(target[:3], "url") {
+		return "", false
+	}
+	target = strings.TrimSpace(target[3:])
+	target, ok = strings.CutPrefix(target, "=")
+	if !ok {
+		return "", false
+	}
+	target = strings.Trim(strings.TrimSpace(target), `'"`)
+	return target, target != ""
 }
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"net/url"
 	"testing"
 
+	"github.com/samber/lo"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -86,3 +88,187 @@ func TestExtractLinks_ComplexHTML(t *testing.T) {
 	assert.NoError(t, err)
 	assert.ElementsMatch(t, expectedLinks, links)
 }
+
+// urlsAndKinds strips everything but the URL and kind from links, for tests that don't care about link metadata.
+func urlsAndKinds(links []Link) []Link {
+	return lo.Map(links, func(link Link, _ int) Link { return Link{URL: link.URL, Kind: link.Kind} })
+}
+
+func TestParseDocument_ReturnsTypedLinksInDocumentOrder(t *testing.T) {
+	html := `
+	<html>
+		<head>
+			<meta http-equiv="Refresh" content="5; URL='/next'">
+			<link rel="stylesheet" href="/style.css">
+			<link rel="alternate" hreflang="fr" href="/fr/">
+			<link rel="icon" href="/favicon.ico">
+			<script src="/app.js"></script>
+			<script>inline()</script>
+		</head>
+		<body>
+			<a href="/anchor">Anchor</a>
+			<map><area href="/area"></map>
+			<iframe src="/iframe"></iframe>
+			<frameset><frame src="/frame"></frameset>
+			<form action="/search"></form>
+			<form method="post" action="/login"></form>
+			<img src="/small.jpg" srcset="/medium.jpg 2x, /large.jpg 3x">
+			<picture><source srcset="/wide.webp 1200w"></picture>
+		</body>
+	</html>
+	`
+
+	doc, err := ParseDocument(html)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []Link{
+		{URL: "/next", Kind: LinkRefresh},
+		{URL: "/style.css", Kind: LinkStylesheet},
+		{URL: "/fr/", Kind: LinkAlternate},
+		{URL: "/app.js", Kind: LinkScript},
+		{URL: "/anchor", Kind: LinkAnchor},
+		{URL: "/area", Kind: LinkArea},
+		{URL: "/iframe", Kind: LinkIframe},
+		{URL: "/search", Kind: LinkForm},
+		{URL: "/small.jpg", Kind: LinkImage},
+		{URL: "/medium.jpg", Kind: LinkImage},
+		{URL: "/large.jpg", Kind: LinkImage},
+		{URL: "/wide.webp", Kind: LinkImage},
+	}, urlsAndKinds(doc.Links), "frames outside a frameset document are dropped by the parser")
+}
+
+func TestParseDocument_FramesInFramesetDocument(t *testing.T) {
+	html := `<html><frameset><frame src="/left"><frame src="/right"></frameset></html>`
+
+	doc, err := ParseDocument(html)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []Link{{URL: "/left", Kind: LinkFrame}, {URL: "/right", Kind: LinkFrame}}, urlsAndKinds(doc.Links))
+}
+
+func TestParseDocument_SplitsPagesFromAssets(t *testing.T) {
+	html := `<body><a href="/page">Page</a><img src="/img.png"><script src="/app.js"></script></body>`
+
+	doc, err := ParseDocument(html)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []Link{{URL: "/page", Kind: LinkAnchor}}, urlsAndKinds(doc.PageLinks()))
+	assert.Equal(t, []Link{{URL: "/img.png", Kind: LinkImage}, {URL: "/app.js", Kind: LinkScript}}, urlsAndKinds(doc.AssetLinks()))
+}
+
+func TestParseRefreshURL(t *testing.T) {
+	tests := map[string]string{
+		"0; url=/next":        "/next",
+		"0;URL = \"/quoted\"": "/quoted",
+		"5":                   "",
+		"5; /no-url-key":      "",
+		"0; url=":             "",
+	}
+	for content, expected := range tests {
+		target, ok := parseRefreshURL(content)
+		assert.Equal(t, expected != "", ok, content)
+		assert.Equal(t, expected, target, content)
+	}
+}
+
+func TestExtractLinks_IgnoresNonAnchorLinks(t *testing.T) {
+	html := `<body><a href="/a">A</a><iframe src="/iframe"></iframe><img src="/img.png"></body>`
+
+	links, err := ExtractLinks(html)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/a"}, links)
+}
+
+func TestParseDocument_ReturnsFirstBaseHref(t *testing.T) {
+	html := `<html><head><base target="_blank"><base href="/docs/"><base href="/ignored/"></head></html>`
+
+	doc, err := ParseDocument(html)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "/docs/", doc.Base)
+}
+
+func TestDocument_ResolveBase(t *testing.T) {
+	pageURL, _ := url.Parse("https://example.com/guides/intro/page.html")
+	tests := []struct {
+		name     string
+		base     string
+		expected string
+	}{
+		{name: "no base", base: "", expected: "https://example.com/guides/intro/page.html"},
+		{name: "absolute path", base: "/docs/", expected: "https://example.com/docs/"},
+		{name: "relative", base: "../", expected: "https://example.com/guides/"},
+		{name: "other host", base: "https://cdn.example.com/", expected: "https://cdn.example.com/"},
+		{name: "javascript is ignored", base: "javascript:void(0)", expected: "https://example.com/guides/intro/page.html"},
+		{name: "unparseable is ignored", base: "http://[::1", expected: "https://example.com/guides/intro/page.html"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := &Document{Base: tt.base}
+			assert.Equal(t, tt.expected, doc.ResolveBase(pageURL).String())
+		})
+	}
+}
+
+func TestParseDocument_ReturnsLinkMetadata(t *testing.T) {
+	html := `
+	<html>
+		<body>
+			<header><nav><a href="/home" title="Home page">  Home
+				page </a></nav></header>
+			<div role="contentinfo"><a href="/terms" rel="Nofollow  noopener">Terms</a></div>
+			<main>
+				<a href="/fr/" hreflang="fr" rel="alternate"><img src="/flag.png" alt="French"> version</a>
+				<map><area href="/region" alt="Region"></map>
+			</main>
+			<aside><a href="/ad" rel="sponsored ugc">Ad</a></aside>
+			<a href="/loose">Loose</a>
+		</body>
+	</html>
+	`
+
+	doc, err := ParseDocument(html)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []Link{
+		{URL: "/home", Kind: LinkAnchor, Text: "Home page", Title: "Home page", Section: SectionNav, Position: 0},
+		{URL: "/terms", Kind: LinkAnchor, Text: "Terms", Rel: []string{"nofollow", "noopener"}, Section: SectionFooter, Position: 1},
+		{URL: "/fr/", Kind: LinkAnchor, Text: "French version", Rel: []string{"alternate"}, Hreflang: "fr", Section: SectionMain, Position: 2},
+		{URL: "/flag.png", Kind: LinkImage, Section: SectionMain, Position: 3},
+		{URL: "/region", Kind: LinkArea, Text: "Region", Section: SectionMain, Position: 4},
+		{URL: "/ad", Kind: LinkAnchor, Text: "Ad", Rel: []string{"sponsored", "ugc"}, Section: SectionAside, Position: 5},
+		{URL: "/loose", Kind: LinkAnchor, Text: "Loose", Section: SectionNone, Position: 6},
+	}, doc.Links)
+	assert.True(t, doc.Links[1].HasRel("NoFollow"))
+	assert.False(t, doc.Links[0].HasRel("nofollow"))
+}
+
+func TestParseDocument_ReturnsFirstCanonical(t *testing.T) {
+	html := `<head><link rel="alternate" href="/fr/"><link rel="Canonical" href="/page"><link rel="canonical" href="/other"></head>`
+
+	doc, err := ParseDocument(html)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "/page", doc.Canonical)
+}
+
+func TestDocument_FeedLinks(t *testing.T) {
+	t.Parallel()
+	doc, err := ParseDocument(`<head>
+		<link rel="alternate" type="application/rss+xml" title="News" href="/news.rss">
+		<link rel="alternate" type=" Application/Atom+XML " href="/atom.xml">
+		<link rel="alternate" hreflang="fr" href="/fr/">
+		<a href="/feed.rss" type="application/rss+xml">Not a link element</a>
+	</head>`)
+	assert.NoError(t, err)
+	feeds := doc.FeedLinks()
+	if !assert.Len(t, feeds, 2) {
+		return
+	}
+	assert.Equal(t, "/news.rss", feeds[0].URL)
+	assert.Equal(t, "application/rss+xml", feeds[0].Type)
+	assert.Equal(t, "News", feeds[0].Title)
+	assert.Equal(t, "/atom.xml", feeds[1].URL)
+	assert.Equal(t, "application/atom+xml", feeds[1].Type)
+}
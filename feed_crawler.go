@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"strings"
+)
+
+// DefaultFeedPaths are where sites commonly publish their RSS or Atom feed.
+var DefaultFeedPaths = []string{"/feed", "/rss", "/feed.xml", "/rss.xml", "/atom.xml", "/index.xml"}
+
+// CrawlFromFeeds queues the feeds at FeedPaths on each seed's site, to be read by the crawl workers, which add their
+// items' links to the crawl queue. Paths with no feed are skipped quietly.
+func (sc *SiteCrawler) CrawlFromFeeds(ctx context.Context) {
+	for i := range sc.Seeds {
+		seed := sc.canonicalSeed(i)
+		for _, path := range sc.FeedPaths {
+			feedURL, err := seed.Parse(path)
+			if err != nil {
+				sc.Logger.Warn("Skipping invalid feed path %s: %v", path, err)
+				continue
+			}
+			sc.AddURLToCrawlQueue(ctx, FrontierItem{URL: feedURL.String(), Feed: true})
+		}
+	}
+}
+
+// CrawlFeed fetches an RSS or Atom feed popped from the frontier and adds its items' links to the crawl queue at the
+// feed's depth. Relative links are resolved against the feed's URL. Feeds aren't post-processed, and don't count
+// towards the MaxPages or PathBudgets crawl limits, so probing FeedPaths that don't exist costs no pages.
+func (sc *SiteCrawler) CrawlFeed(ctx context.Context, item FrontierItem) {
+	feedURL, err := url.Parse(item.URL)
+	if err != nil {
+		sc.Logger.Warn("Skipping unparseable feed URL %s: %v", item.URL, err)
+		return
+	}
+	if sc.Limits.bytesExhausted(sc.Stats.BytesDownloaded()) {
+		sc.Logger.Debug("Byte budget exhausted, skipping feed: %s", item.URL)
+		sc.Stats.ForHost(feedURL.Host).RecordSkip(SkipMaxBytes)
+		return
+	}
+
+	result, err := sc.fetch(ctx, feedURL, Validators{})
+	if err != nil {
+		sc.Logger.Debug("No feed at %s: %v", item.URL, err)
+		return
+	}
+	feed, err := ParseFeedReader(strings.NewReader(result.Body))
+	if err != nil {
+		sc.Logger.Debug("Failed to parse feed %s: %v", item.URL, err)
+		return
+	}
+	base := feedURL
+	if result.FinalURL != nil {
+		base = result.FinalURL
+	}
+	sc.Logger.Debug("Feed %s lists %d items", item.URL, len(feed.Items))
+	for _, feedItem := range feed.Items {
+		link, err := ResolveAndCleanURL(base, feedItem.Link)
+		if err != nil {
+			sc.Logger.Warn("Skipping invalid link in feed %s: %s", item.URL, feedItem.Link)
+			continue
+		}
+		sc.AddURLToCrawlQueue(ctx, FrontierItem{URL: link.String(), Source: SourceFeed, Depth: item.Depth})
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestSiteCrawler_Crawl_DiscoversFeedsAndTagsSources(t *testing.T) {
+	fetcher := &FakeFetcher{Pages: map[string]string{
+		"/robots.txt":  "User-agent: *\nDisallow: /private-feed.xml",
+		"/sitemap.xml": `<urlset><url><loc>/from-sitemap</loc></url></urlset>`,
+		"/": `<head>
+			<link rel="alternate" type="application/rss+xml" href="/news.rss">
+			<link rel="alternate" type="application/atom+xml" href="/private-feed.xml">
+			<link rel="alternate" hreflang="de" href="/de/">
+		</head><body><a href="/from-link">Link</a></body>`,
+		"/news.rss":         `<rss><channel><title>News</title><item><link>/from-page-feed</link></item></channel></rss>`,
+		"/atom.xml":         `<feed><entry><link href="https://example.com/from-common-feed"/></entry></feed>`,
+		"/feed":             `<html><body>Not a feed</body></html>`,
+		"/from-sitemap":     "Sitemap",
+		"/from-link":        "Link",
+		"/from-page-feed":   "Page feed",
+		"/from-common-feed": "Common feed",
+		"/de/":              "Deutsch",
+	}}
+	spy := &SpyProcessor{}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	crawler, err := NewSiteCrawler(ctx, *mustParse(t, "https://example.com/"), &StdoutLogger{}, 1000, "Crawler", 2, []PostProcessor{spy}, fetcher)
+	require.NoError(t, err)
+	crawler.DiscoverFeeds = true
+
+	require.NoError(t, crawler.Crawl(ctx))
+
+	sources := map[string]URLSource{}
+	spy.Pages.Range(func(key, value any) bool {
+		sources[key.(string)] = value.(*CrawledPage).Source
+		return true
+	})
+	assert.Equal(t, map[string]URLSource{
+		"https://example.com/":                 SourceSeed,
+		"https://example.com/from-sitemap":     SourceSitemap,
+		"https://example.com/from-link":        SourceLink,
+		"https://example.com/de/":              SourceLink,
+		"https://example.com/from-page-feed":   SourceFeed,
+		"https://example.com/from-common-feed": SourceFeed,
+	}, sources)
+	_, requested := fetcher.Requested.Load("/private-feed.xml")
+	assert.False(t, requested, "feeds are subject to robots.txt")
+}
+
+func TestSiteCrawler_Crawl_FollowsFeedLinksAsPagesWithoutDiscovery(t *testing.T) {
+	fetcher := &FakeFetcher{Pages: map[string]string{
+		"/":         `<head><link rel="alternate" type="application/rss+xml" href="/news.rss"></head>`,
+		"/news.rss": `<rss><channel><item><link>/story</link></item></channel></rss>`,
+		"/story":    "Story",
+	}}
+	spy := &SpyProcessor{}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	crawler, err := NewSiteCrawler(ctx, *mustParse(t, "https://example.com/"), &StdoutLogger{}, 1000, "Crawler", 1, []PostProcessor{spy}, fetcher)
+	require.NoError(t, err)
+
+	require.NoError(t, crawler.Crawl(ctx))
+
+	_, crawledFeed := spy.Pages.Load("https://example.com/news.rss")
+	assert.True(t, crawledFeed)
+	_, crawledStory := spy.Pages.Load("https://example.com/story")
+	assert.False(t, crawledStory)
+	_, requested := fetcher.Requested.Load("/atom.xml")
+	assert.False(t, requested)
+}
+
+func TestSiteCrawler_Crawl_QueuesPageFeedsWithinScopeAndFilter(t *testing.T) {
+	fetcher := &FakeFetcher{Pages: map[string]string{
+		"/": `<head>
+			<link rel="alternate" type="application/rss+xml" href="https://other.example/other.rss">
+			<link rel="alternate" type="application/rss+xml" href="/denied.rss">
+			<link rel="alternate" type="application/rss+xml" href="/news.rss">
+		</head>`,
+		"/other.rss":  `<rss><channel><item><link>https://example.com/from-other-feed</link></item></channel></rss>`,
+		"/denied.rss": `<rss><channel><item><link>/from-denied-feed</link></item></channel></rss>`,
+		"/news.rss":   `<rss><channel><item><link>/story</link></item></channel></rss>`,
+		"/story":      "Story",
+	}}
+	spy := &SpyProcessor{}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	crawler, err := NewSiteCrawler(ctx, *mustParse(t, "https://example.com/"), &StdoutLogger{}, 1000, "Crawler", 1, []PostProcessor{spy}, fetcher)
+	require.NoError(t, err)
+	crawler.DiscoverFeeds = true
+	crawler.FeedPaths = nil
+	crawler.Filter = &URLFilter{Deny: []URLRule{PathPrefixRule("/denied")}}
+
+	require.NoError(t, crawler.Crawl(ctx))
+
+	_, crawledStory := spy.Pages.Load("https://example.com/story")
+	assert.True(t, crawledStory)
+	_, crawledFeed := spy.Pages.Load("https://example.com/news.rss")
+	assert.False(t, crawledFeed, "feeds aren't post-processed as pages")
+	for _, path := range []string{"/other.rss", "/denied.rss"} {
+		_, requested := fetcher.Requested.Load(path)
+		assert.False(t, requested, "%s should not be fetched", path)
+	}
+	stats := crawler.Stats.Snapshot()
+	assert.Equal(t, int64(1), stats.Hosts["other.example"].Skipped[SkipOutOfScope])
+	assert.Equal(t, int64(1), stats.Hosts["example.com"].Skipped[SkipFiltered])
+}
+
+func TestSiteCrawler_Crawl_FeedsDontUseUpThePageBudget(t *testing.T) {
+	fetcher := &FakeFetcher{Pages: map[string]string{
+		"/":         `<body><a href="/a">a</a><a href="/b">b</a><a href="/c">c</a><a href="/d">d</a><a href="/e">e</a></body>`,
+		"/atom.xml": `<feed><entry><link href="/f"/></entry></feed>`,
+		"/a":        "A",
+		"/b":        "B",
+		"/c":        "C",
+		"/d":        "D",
+		"/e":        "E",
+		"/f":        "F",
+	}}
+	spy := &SpyProcessor{}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	crawler, err := NewSiteCrawler(ctx, *mustParse(t, "https://example.com/"), &StdoutLogger{}, 1000, "Crawler", 1, []PostProcessor{spy}, fetcher)
+	require.NoError(t, err)
+	crawler.DiscoverFeeds = true
+	crawler.Limits.MaxPages = 5
+
+	require.NoError(t, crawler.Crawl(ctx))
+
+	assert.Equal(t, int32(5), spy.CallCount.Load(), "the feed probes, found or not, shouldn't count as pages")
+	_, crawledSeed := spy.Pages.Load("https://example.com/")
+	assert.True(t, crawledSeed)
+	for _, path := range DefaultFeedPaths {
+		_, requested := fetcher.Requested.Load(path)
+		assert.True(t, requested, "%s should still be probed", path)
+	}
+}
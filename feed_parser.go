@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// ErrNotAFeed is returned when parsing a document that isn't an RSS or Atom feed.
+var ErrNotAFeed = errors.New("not an RSS or Atom feed")
+
+// Feed is a parsed RSS (0.9x, 1.0 or 2.0) or Atom feed.
+type Feed struct {
+	Title string
+	Items []FeedItem
+}
+
+// FeedItem is an RSS <item> or Atom <entry>.
+type FeedItem struct {
+	Link      string // The item's page, as written in the feed (it may be relative)
+	Title     string
+	Published string // RSS pubDate (or dc:date), or Atom published (or updated), as written in the feed
+}
+
+// rssItem is an RSS <item>. Link is a slice as items sometimes carry an <atom:link> alongside their <link>.
+type rssItem struct {
+	Links   []string `xml:"link"`
+	GUID    rssGUID  `xml:"guid"`
+	Title   string   `xml:"title"`
+	PubDate string   `xml:"pubDate"`
+	Date    string   `xml:"date"`
+}
+
+type rssGUID struct {
+	Value       string `xml:",chardata"`
+	IsPermaLink string `xml:"isPermaLink,attr"`
+}
+
+// atomEntry is an Atom <entry>.
+type atomEntry struct {
+	Links     []atomLink `xml:"link"`
+	Title     string     `xml:"title"`
+	Published string     `xml:"published"`
+	Updated   string     `xml:"updated"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+}
+
+// ParseFeed parses an RSS or Atom feed, keeping only the items with a link.
+func ParseFeed(feed string) (*Feed, error) {
+	return ParseFeedReader(strings.NewReader(feed))
+}
+
+// ParseFeedReader parses an RSS or Atom feed as it is read, keeping only the items with a link. It returns
+// ErrNotAFeed if the document's root element isn't <rss>, <rdf:RDF> or <feed>.
+func ParseFeedReader(r io.Reader) (*Feed, error) {
+	var feed Feed
+	decoder := xml.NewDecoder(r)
+	sawRoot := false
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if !sawRoot {
+			switch start.Name.Local {
+			case "rss", "RDF", "feed":
+				sawRoot = true
+				continue
+			default:
+				return nil, ErrNotAFeed
+			}
+		}
+		switch start.Name.Local {
+		case "title":
+			// Channel and feed titles come before the items
+			var title string
+			if err := decoder.DecodeElement(&title, &start); err != nil {
+				return nil, err
+			}
+			if feed.Title == "" && len(feed.Items) == 0 {
+				feed.Title = strings.TrimSpace(title)
+			}
+		case "item":
+			var item rssItem
+			if err := decoder.DecodeElement(&item, &start); err != nil {
+				return nil, err
+			}
+			if link := item.link(); link != "" {
+				feed.Items = append(feed.Items, FeedItem{Link: link, Title: strings.TrimSpace(item.Title), Published: firstNonEmpty(item.PubDate, item.Date)})
+			}
+		case "entry":
+			var entry atomEntry
+			if err := decoder.DecodeElement(&entry, &start); err != nil {
+				return nil, err
+			}
+			if link := entry.link(); link != "" {
+				feed.Items = append(feed.Items, FeedItem{Link: link, Title: strings.TrimSpace(entry.Title), Published: firstNonEmpty(entry.Published, entry.Updated)})
+			}
+		}
+	}
+	if !sawRoot {
+		return nil, ErrNotAFeed
+	}
+	return &feed, nil
+}
+
+// link returns the item's <link>, or its <guid> if that is a permalink URL.
+func (i rssItem) link() string {
+	for _, link := range i.Links {
+		if link = strings.TrimSpace(link); link != "" {
+			return link
+		}
+	}
+	guid := strings.TrimSpace(i.GUID.Value)
+	if strings.EqualFold(i.GUID.IsPermaLink, "false") {
+		return ""
+	}
+	if parsed, err := url.Parse(guid); err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") {
+		return guid
+	}
+	return ""
+}
+
+// link returns the entry's alternate link, which is the one with rel="alternate" or no rel at all.
+func (e atomEntry) link() string {
+	for _, link := range e.Links {
+		if link.Rel == "" || link.Rel == "alternate" {
+			return strings.TrimSpace(link.Href)
+		}
+	}
+	return ""
+}
+
+// firstNonEmpty returns the first of values that isn't blank, trimmed.
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestParseFeed_ReadsRSS2(t *testing.T) {
+	t.Parallel()
+	feed := `<?xml version="1.0"?>
+	<rss version="2.0" xmlns:atom="http://www.w3.org/2005/Atom">
+	<channel>
+		<title>Example News</title>
+		<atom:link href="https://example.com/feed" rel="self"/>
+		<image><title>Logo</title><url>https://example.com/logo.png</url></image>
+		<item>
+			<title>First story</title>
+			<link>https://example.com/news/1</link>
+			<pubDate>Fri, 01 Mar 2024 10:00:00 GMT</pubDate>
+		</item>
+		<item>
+			<title>Permalink only</title>
+			<guid>https://example.com/news/2</guid>
+		</item>
+		<item>
+			<title>Not a permalink</title>
+			<guid isPermaLink="false">https://example.com/news/3</guid>
+		</item>
+		<item><title>No link at all</title></item>
+	</channel>
+	</rss>`
+	parsed, err := ParseFeed(feed)
+	require.NoError(t, err)
+	assert.Equal(t, "Example News", parsed.Title)
+	assert.Equal(t, []FeedItem{
+		{Link: "https://example.com/news/1", Title: "First story", Published: "Fri, 01 Mar 2024 10:00:00 GMT"},
+		{Link: "https://example.com/news/2", Title: "Permalink only"},
+	}, parsed.Items)
+}
+
+func TestParseFeed_ReadsRSS1(t *testing.T) {
+	t.Parallel()
+	feed := `<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#" xmlns="http://purl.org/rss/1.0/" xmlns:dc="http://purl.org/dc/elements/1.1/">
+	<channel><title>Old School</title><link>https://example.com/</link></channel>
+	<item><title>Story</title><link>https://example.com/story</link><dc:date>2024-03-01</dc:date></item>
+	</rdf:RDF>`
+	parsed, err := ParseFeed(feed)
+	require.NoError(t, err)
+	assert.Equal(t, "Old School", parsed.Title)
+	assert.Equal(t, []FeedItem{{Link: "https://example.com/story", Title: "Story", Published: "2024-03-01"}}, parsed.Items)
+}
+
+func TestParseFeed_ReadsAtom(t *testing.T) {
+	t.Parallel()
+	feed := `<feed xmlns="http://www.w3.org/2005/Atom">
+	<title>Example Blog</title>
+	<link href="https://example.com/atom.xml" rel="self"/>
+	<entry>
+		<title>Post</title>
+		<link href="https://example.com/comments/1" rel="replies"/>
+		<link href="/posts/1"/>
+		<published>2024-03-01T10:00:00Z</published>
+		<updated>2024-03-02T10:00:00Z</updated>
+	</entry>
+	<entry>
+		<title>Updated only</title>
+		<link href="https://example.com/posts/2" rel="alternate"/>
+		<updated>2024-03-02T10:00:00Z</updated>
+	</entry>
+	</feed>`
+	parsed, err := ParseFeed(feed)
+	require.NoError(t, err)
+	assert.Equal(t, "Example Blog", parsed.Title)
+	assert.Equal(t, []FeedItem{
+		{Link: "/posts/1", Title: "Post", Published: "2024-03-01T10:00:00Z"},
+		{Link: "https://example.com/posts/2", Title: "Updated only", Published: "2024-03-02T10:00:00Z"},
+	}, parsed.Items)
+}
+
+func TestParseFeed_RejectsOtherDocuments(t *testing.T) {
+	t.Parallel()
+	_, err := ParseFeed(`<urlset><url><loc>https://example.com/</loc></url></urlset>`)
+	assert.ErrorIs(t, err, ErrNotAFeed)
+	_, err = ParseFeed("")
+	assert.ErrorIs(t, err, ErrNotAFeed)
+	_, err = ParseFeed(`<rss><channel><item>`)
+	assert.Error(t, err)
+}
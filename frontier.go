@@ -0,0 +1,386 @@
+package main
+
+import (
+	"bufio"
+	"container/heap"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"slices"
+	"sync"
+)
+
+// defaultFrontierMemoryLimit is how many URLs the crawler keeps in memory before spilling to disk.
+const defaultFrontierMemoryLimit = 10000
+
+// ErrFrontierClosed is returned when pushing to a frontier that has been closed.
+var ErrFrontierClosed = errors.New("frontier is closed")
+
+// URLSource says how the crawler discovered a URL.
+type URLSource string
+
+const (
+	SourceSeed    URLSource = "seed"    // One of the crawl's seeds
+	SourceSitemap URLSource = "sitemap" // Listed in a sitemap
+	SourceLink    URLSource = "link"    // Linked from a crawled page
+	SourceFeed    URLSource = "feed"    // An item in an RSS or Atom feed
+)
+
+// FrontierItem is a URL waiting to be crawled.
+type FrontierItem struct {
+	URL    string    `json:"url"`
+	Source URLSource `json:"source,omitempty"` // How the URL was discovered
+	Depth  int       `json:"depth"`            // Number of links followed from a seed to reach this URL
+	Feed   bool      `json:"feed,omitempty"`   // The URL is an RSS or Atom feed to read, rather than a page
+	// Sitemap is the sitemap entry, if the URL came from a sitemap. Its extensions are only kept if the crawler's
+	// RecordSitemapExtensions is set, as every item in memory, spilled to disk or checkpointed carries them.
+	Sitemap *UrlEntry `json:"sitemap,omitempty"`
+}
+
+// PriorityScorer scores a frontier item; items with higher scores are crawled first.
+type PriorityScorer func(item FrontierItem) float64
+
+// DefaultPriorityScorer crawls breadth-first by depth. Within a depth, URLs with a higher sitemap <priority> go first.
+func DefaultPriorityScorer(item FrontierItem) float64 {
+	score := -float64(item.Depth)
+	if item.Sitemap != nil && item.Sitemap.Priority != nil {
+		score += min(max(*item.Sitemap.Priority, 0), 1) * 0.5
+	}
+	return score
+}
+
+// Frontier holds the URLs that have been discovered but not yet crawled.
+// Push must never block, so that workers adding links can't deadlock the crawl.
+type Frontier interface {
+	// Push adds an item to the frontier.
+	Push(item FrontierItem) error
+	// Pop blocks until an item is available, returning false once the frontier is closed or ctx is done.
+	// The item stays in flight until it is acknowledged with Done.
+	Pop(ctx context.Context) (FrontierItem, bool)
+	// Done acknowledges that a popped item has been fully processed.
+	Done(item FrontierItem)
+	// Len returns the number of items waiting in the frontier, excluding those in flight.
+	Len() int
+	// Snapshot returns every item that is waiting or in flight, for checkpointing.
+	Snapshot() ([]FrontierItem, error)
+	// Close stops the frontier; pending Pops return false and further Pushes fail.
+	Close() error
+}
+
+// DroppingFrontier is a Frontier that can lose items it has accepted, for example when its spill file can't be read
+// back. The crawler registers a handler so that it stops waiting for items that will never be popped.
+type DroppingFrontier interface {
+	Frontier
+	// OnDrop sets the function called, outside the frontier's lock, with the number of items lost and why.
+	OnDrop(handler func(dropped int, err error))
+}
+
+// SpillingFrontier is a priority frontier that keeps up to memoryLimit items in memory and spills the rest to a
+// newline-delimited JSON file on disk, so the queue's memory use stays fixed however large the site is.
+//
+// Items in memory are popped in score order (ties broken first in, first out). Spilled items are read back in the
+// order they were written whenever memory drains to half full, so ordering is only approximate once a crawl has
+// spilled; with the default depth-based scorer items are spilled in roughly priority order anyway.
+type SpillingFrontier struct {
+	memoryLimit int
+	spillDir    string
+	scorer      PriorityScorer
+
+	mu        sync.Mutex
+	memory    frontierHeap
+	sequence  uint64
+	spillFile *os.File // append-only handle used for writing
+	readFile  *os.File // separate handle for reading, so reads and writes keep independent offsets
+	writer    *bufio.Writer
+	reader    *bufio.Reader
+	written   int // Items written to the spill file since it was last truncated
+	spilled   int // Items in the spill file that haven't been read back yet
+	inFlight  map[string]FrontierItem
+	closed    bool
+	available chan struct{}
+	onDrop    func(dropped int, err error)
+}
+
+// NewSpillingFrontier creates a SpillingFrontier. The spill file is created lazily in spillDir (os.TempDir() if
+// empty) the first time memoryLimit is exceeded. A nil scorer means DefaultPriorityScorer.
+func NewSpillingFrontier(memoryLimit int, spillDir string, scorer PriorityScorer) *SpillingFrontier {
+	if spillDir == "" {
+		spillDir = os.TempDir()
+	}
+	if scorer == nil {
+		scorer = DefaultPriorityScorer
+	}
+	return &SpillingFrontier{
+		memoryLimit: max(memoryLimit, 1),
+		spillDir:    spillDir,
+		scorer:      scorer,
+		inFlight:    make(map[string]FrontierItem),
+		available:   make(chan struct{}),
+	}
+}
+
+// Push adds an item to the frontier. Once anything has been spilled, new items also go to disk so that spilled items
+// aren't starved by newer ones.
+func (f *SpillingFrontier) Push(item FrontierItem) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return ErrFrontierClosed
+	}
+	if f.spilled == 0 && len(f.memory) < f.memoryLimit {
+		f.pushMemory(item)
+		f.notify()
+		return nil
+	}
+	if err := f.spill(item); err != nil {
+		return err
+	}
+	f.notify()
+	return nil
+}
+
+// Pop removes the highest priority item, blocking until there is one.
+func (f *SpillingFrontier) Pop(ctx context.Context) (FrontierItem, bool) {
+	for {
+		f.mu.Lock()
+		if f.closed {
+			f.mu.Unlock()
+			return FrontierItem{}, false
+		}
+		dropped, dropErr := 0, error(nil)
+		if len(f.memory) <= f.memoryLimit/2 && f.spilled > 0 {
+			if err := f.refill(); err != nil {
+				// A broken spill file can't be recovered from, drop what's left rather than spin on it
+				dropped, dropErr = f.spilled, err
+				if err := f.resetSpill(); err != nil {
+					dropErr = errors.Join(dropErr, err)
+				}
+			}
+		}
+		onDrop := f.onDrop
+		if len(f.memory) > 0 {
+			entry := heap.Pop(&f.memory).(frontierEntry)
+			f.inFlight[entry.item.URL] = entry.item
+			f.mu.Unlock()
+			if dropped > 0 && onDrop != nil {
+				onDrop(dropped, dropErr)
+			}
+			return entry.item, true
+		}
+		available := f.available
+		f.mu.Unlock()
+		if dropped > 0 && onDrop != nil {
+			onDrop(dropped, dropErr)
+		}
+
+		select {
+		case <-ctx.Done():
+			return FrontierItem{}, false
+		case <-available:
+		}
+	}
+}
+
+// OnDrop sets the function called when spilled items are lost because the spill file can't be read back.
+func (f *SpillingFrontier) OnDrop(handler func(dropped int, err error)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.onDrop = handler
+}
+
+// Done removes a popped item from the in-flight set.
+func (f *SpillingFrontier) Done(item FrontierItem) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.inFlight, item.URL)
+}
+
+// Len returns the number of items in memory and on disk.
+func (f *SpillingFrontier) Len() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.memory) + f.spilled
+}
+
+// Snapshot returns the in-flight items, then the in-memory items by priority, then the unread items on disk.
+func (f *SpillingFrontier) Snapshot() ([]FrontierItem, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	items := make([]FrontierItem, 0, len(f.inFlight)+len(f.memory)+f.spilled)
+	for _, item := range f.inFlight {
+		items = append(items, item)
+	}
+	entries := slices.Clone(f.memory)
+	slices.SortFunc(entries, func(a, b frontierEntry) int {
+		if a.before(b) {
+			return -1
+		}
+		return 1
+	})
+	for _, entry := range entries {
+		items = append(items, entry.item)
+	}
+	if f.spilled == 0 {
+		return items, nil
+	}
+
+	if err := f.writer.Flush(); err != nil {
+		return nil, err
+	}
+	file, err := os.Open(f.spillFile.Name())
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+	for i := 0; i < f.written; i++ {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			return nil, err
+		}
+		if i < f.written-f.spilled {
+			continue
+		}
+		var item FrontierItem
+		if err := json.Unmarshal(line, &item); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// Close wakes up any blocked Pops and removes the spill file.
+func (f *SpillingFrontier) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+	f.notify()
+	if f.spillFile == nil {
+		return nil
+	}
+	name := f.spillFile.Name()
+	return errors.Join(f.spillFile.Close(), f.readFile.Close(), os.Remove(name))
+}
+
+// spill appends an item to the spill file, creating it if needed. The caller must hold f.mu.
+func (f *SpillingFrontier) spill(item FrontierItem) error {
+	if f.spillFile == nil {
+		file, err := os.CreateTemp(f.spillDir, "frontier-*.jsonl")
+		if err != nil {
+			return err
+		}
+		readFile, err := os.Open(file.Name())
+		if err != nil {
+			return errors.Join(err, file.Close(), os.Remove(file.Name()))
+		}
+		f.spillFile = file
+		f.readFile = readFile
+		f.writer = bufio.NewWriter(file)
+		f.reader = bufio.NewReader(readFile)
+	}
+	line, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	if _, err := f.writer.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	f.written++
+	f.spilled++
+	return nil
+}
+
+// refill moves the next batch of items from disk into memory. The caller must hold f.mu.
+func (f *SpillingFrontier) refill() error {
+	if err := f.writer.Flush(); err != nil {
+		return err
+	}
+	for len(f.memory) < f.memoryLimit && f.spilled > 0 {
+		line, err := f.reader.ReadBytes('\n')
+		if err != nil {
+			return err
+		}
+		var item FrontierItem
+		if err := json.Unmarshal(line, &item); err != nil {
+			return err
+		}
+		f.pushMemory(item)
+		f.spilled--
+	}
+	if f.spilled == 0 {
+		// Everything on disk has been read back, start the file again so it doesn't grow forever
+		return f.resetSpill()
+	}
+	return nil
+}
+
+// resetSpill empties the spill file, discarding anything left in it, and rewinds both handles. The caller must hold
+// f.mu.
+func (f *SpillingFrontier) resetSpill() error {
+	f.written = 0
+	f.spilled = 0
+	f.writer.Reset(f.spillFile)
+	f.reader.Reset(f.readFile)
+	if err := f.spillFile.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := f.spillFile.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	_, err := f.readFile.Seek(0, io.SeekStart)
+	return err
+}
+
+// pushMemory scores an item and adds it to the in-memory heap. The caller must hold f.mu.
+func (f *SpillingFrontier) pushMemory(item FrontierItem) {
+	f.sequence++
+	heap.Push(&f.memory, frontierEntry{item: item, score: f.scorer(item), sequence: f.sequence})
+}
+
+// notify wakes up everything blocked in Pop. The caller must hold f.mu.
+func (f *SpillingFrontier) notify() {
+	close(f.available)
+	f.available = make(chan struct{})
+}
+
+// frontierEntry is a scored item in the in-memory tier of the frontier.
+type frontierEntry struct {
+	item     FrontierItem
+	score    float64
+	sequence uint64
+}
+
+// before reports whether e should be popped before other: higher scores first, oldest first on ties.
+func (e frontierEntry) before(other frontierEntry) bool {
+	if e.score != other.score {
+		return e.score > other.score
+	}
+	return e.sequence < other.sequence
+}
+
+// frontierHeap is a max-heap of frontier entries by score, oldest first on ties. It implements heap.Interface.
+type frontierHeap []frontierEntry
+
+func (h frontierHeap) Len() int { return len(h) }
+
+func (h frontierHeap) Less(i, j int) bool { return h[i].before(h[j]) }
+
+func (h frontierHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *frontierHeap) Push(x any) { *h = append(*h, x.(frontierEntry)) }
+
+func (h *frontierHeap) Pop() any {
+	old := *h
+	n := len(old)
+	entry := old[n-1]
+	old[n-1] = frontierEntry{}
+	*h = old[:n-1]
+	return entry
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func popN(t *testing.T, f Frontier, n int) []string {
+	var urls []string
+	for i := 0; i < n; i++ {
+		item, ok := f.Pop(context.Background())
+		require.True(t, ok)
+		urls = append(urls, item.URL)
+	}
+	return urls
+}
+
+func TestSpillingFrontier_IsFIFOInMemory(t *testing.T) {
+	t.Parallel()
+	f := NewSpillingFrontier(10, t.TempDir(), nil)
+	defer f.Close()
+
+	for _, u := range []string{"/a", "/b", "/c"} {
+		require.NoError(t, f.Push(FrontierItem{URL: u}))
+	}
+	assert.Equal(t, 3, f.Len())
+	assert.Equal(t, []string{"/a", "/b", "/c"}, popN(t, f, 3))
+	assert.Equal(t, 0, f.Len())
+}
+
+func TestSpillingFrontier_SpillsToDiskBeyondMemoryLimit(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	f := NewSpillingFrontier(3, dir, nil)
+
+	var expected []string
+	for i := 0; i < 20; i++ {
+		u := fmt.Sprintf("/page-%d", i)
+		expected = append(expected, u)
+		require.NoError(t, f.Push(FrontierItem{URL: u}))
+	}
+	assert.Equal(t, 20, f.Len())
+	assert.Len(t, f.memory, 3, "only memoryLimit items are held in memory")
+
+	spillFiles, err := filepath.Glob(filepath.Join(dir, "frontier-*.jsonl"))
+	require.NoError(t, err)
+	require.Len(t, spillFiles, 1)
+
+	assert.Equal(t, expected, popN(t, f, 20), "order is preserved across the spill")
+	assert.Equal(t, 0, f.Len())
+
+	require.NoError(t, f.Close())
+	_, err = os.Stat(spillFiles[0])
+	assert.True(t, os.IsNotExist(err), "spill file is removed on close")
+}
+
+func TestSpillingFrontier_InterleavedPushAndPopAcrossSpill(t *testing.T) {
+	t.Parallel()
+	f := NewSpillingFrontier(2, t.TempDir(), nil)
+	defer f.Close()
+
+	var popped []string
+	next := 0
+	for round := 0; round < 5; round++ {
+		for i := 0; i < 5; i++ {
+			require.NoError(t, f.Push(FrontierItem{URL: fmt.Sprintf("/%d", next)}))
+			next++
+		}
+		popped = append(popped, popN(t, f, 3)...)
+	}
+	popped = append(popped, popN(t, f, f.Len())...)
+
+	require.Len(t, popped, 25)
+	for i, u := range popped {
+		assert.Equal(t, fmt.Sprintf("/%d", i), u)
+	}
+}
+
+func TestSpillingFrontier_PopBlocksUntilPush(t *testing.T) {
+	t.Parallel()
+	f := NewSpillingFrontier(10, t.TempDir(), nil)
+	defer f.Close()
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = f.Push(FrontierItem{URL: "/late"})
+	}()
+
+	item, ok := f.Pop(context.Background())
+	require.True(t, ok)
+	assert.Equal(t, "/late", item.URL)
+}
+
+func TestSpillingFrontier_PopReturnsFalseWhenClosedOrCancelled(t *testing.T) {
+	t.Parallel()
+	f := NewSpillingFrontier(10, t.TempDir(), nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, ok := f.Pop(ctx)
+	assert.False(t, ok)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = f.Close()
+	}()
+	_, ok = f.Pop(context.Background())
+	assert.False(t, ok)
+
+	assert.ErrorIs(t, f.Push(FrontierItem{URL: "/after-close"}), ErrFrontierClosed)
+}
+
+func floatPtr(f float64) *float64 {
+	return &f
+}
+
+func TestSpillingFrontier_PopsShallowestFirst(t *testing.T) {
+	t.Parallel()
+	f := NewSpillingFrontier(10, t.TempDir(), nil)
+	defer f.Close()
+
+	require.NoError(t, f.Push(FrontierItem{URL: "/deep", Depth: 3}))
+	require.NoError(t, f.Push(FrontierItem{URL: "/shallow", Depth: 1}))
+	require.NoError(t, f.Push(FrontierItem{URL: "/seed", Depth: 0}))
+	require.NoError(t, f.Push(FrontierItem{URL: "/shallow-2", Depth: 1}))
+
+	assert.Equal(t, []string{"/seed", "/shallow", "/shallow-2", "/deep"}, popN(t, f, 4))
+}
+
+func TestSpillingFrontier_BoostsBySitemapPriorityWithinDepth(t *testing.T) {
+	t.Parallel()
+	f := NewSpillingFrontier(10, t.TempDir(), nil)
+	defer f.Close()
+
+	require.NoError(t, f.Push(FrontierItem{URL: "/no-priority"}))
+	require.NoError(t, f.Push(FrontierItem{URL: "/low", Sitemap: &UrlEntry{Priority: floatPtr(0.1)}}))
+	require.NoError(t, f.Push(FrontierItem{URL: "/high", Sitemap: &UrlEntry{Priority: floatPtr(1.0)}}))
+	require.NoError(t, f.Push(FrontierItem{URL: "/linked", Depth: 1}))
+
+	assert.Equal(t, []string{"/high", "/low", "/no-priority", "/linked"}, popN(t, f, 4))
+}
+
+func TestSpillingFrontier_UsesCustomScorer(t *testing.T) {
+	t.Parallel()
+	newsFirst := func(item FrontierItem) float64 {
+		if strings.HasPrefix(item.URL, "/news/") {
+			return 100
+		}
+		return DefaultPriorityScorer(item)
+	}
+	f := NewSpillingFrontier(10, t.TempDir(), newsFirst)
+	defer f.Close()
+
+	require.NoError(t, f.Push(FrontierItem{URL: "/about", Depth: 0}))
+	require.NoError(t, f.Push(FrontierItem{URL: "/news/today", Depth: 4}))
+
+	assert.Equal(t, []string{"/news/today", "/about"}, popN(t, f, 2))
+}
+
+func TestSpillingFrontier_PreservesMetadataAcrossSpill(t *testing.T) {
+	t.Parallel()
+	f := NewSpillingFrontier(1, t.TempDir(), nil)
+	defer f.Close()
+
+	require.NoError(t, f.Push(FrontierItem{URL: "/first"}))
+	require.NoError(t, f.Push(FrontierItem{URL: "/spilled", Depth: 2, Sitemap: &UrlEntry{Priority: floatPtr(0.7)}}))
+
+	popN(t, f, 1)
+	item, ok := f.Pop(context.Background())
+	require.True(t, ok)
+	assert.Equal(t, FrontierItem{URL: "/spilled", Depth: 2, Sitemap: &UrlEntry{Priority: floatPtr(0.7)}}, item)
+}
+
+func TestSpillingFrontier_SnapshotIncludesInFlightMemoryAndSpilledItems(t *testing.T) {
+	t.Parallel()
+	f := NewSpillingFrontier(2, t.TempDir(), nil)
+	defer f.Close()
+
+	for i := 0; i < 6; i++ {
+		require.NoError(t, f.Push(FrontierItem{URL: fmt.Sprintf("/%d", i)}))
+	}
+	first, ok := f.Pop(context.Background())
+	require.True(t, ok)
+	second, ok := f.Pop(context.Background())
+	require.True(t, ok)
+	f.Done(second)
+
+	snapshot, err := f.Snapshot()
+	require.NoError(t, err)
+	urls := make([]string, 0, len(snapshot))
+	for _, item := range snapshot {
+		urls = append(urls, item.URL)
+	}
+	assert.Equal(t, []string{first.URL, "/2", "/3", "/4", "/5"}, urls)
+	assert.Equal(t, 4, f.Len(), "in-flight items don't count towards Len")
+}
+
+func TestSpillingFrontier_ReportsItemsLostToACorruptSpillFile(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	f := NewSpillingFrontier(1, dir, nil)
+	defer f.Close()
+	var dropped int
+	var dropErr error
+	f.OnDrop(func(n int, err error) {
+		dropped, dropErr = n, err
+	})
+
+	for i := 0; i < 4; i++ {
+		require.NoError(t, f.Push(FrontierItem{URL: fmt.Sprintf("/%d", i)}))
+	}
+	_, err := f.Snapshot() // Flushes the spill file
+	require.NoError(t, err)
+	spillFiles, err := filepath.Glob(filepath.Join(dir, "frontier-*.jsonl"))
+	require.NoError(t, err)
+	require.Len(t, spillFiles, 1)
+	require.NoError(t, os.WriteFile(spillFiles[0], []byte("not json\n"), 0o600))
+
+	assert.Equal(t, []string{"/0"}, popN(t, f, 1))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, ok := f.Pop(ctx)
+	assert.False(t, ok)
+	assert.Equal(t, 3, dropped)
+	assert.Error(t, dropErr)
+	assert.Equal(t, 0, f.Len())
+
+	for i := 4; i < 7; i++ {
+		require.NoError(t, f.Push(FrontierItem{URL: fmt.Sprintf("/%d", i)}))
+	}
+	assert.Equal(t, []string{"/4", "/5", "/6"}, popN(t, f, 3), "the spill file is usable again after a drop")
+}
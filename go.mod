@@ -2,13 +2,16 @@ module goTechTest
 
 go 1.24
 
+require (
+	github.com/samber/lo v1.50.0
+	github.com/stretchr/testify v1.10.0
+	github.com/temoto/robotstxt v1.1.2
+	golang.org/x/net v0.40.0
+)
+
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	github.com/samber/lo v1.50.0 // indirect
-	github.com/stretchr/testify v1.10.0 // indirect
-	github.com/temoto/robotstxt v1.1.2 // indirect
-	golang.org/x/net v0.40.0 // indirect
 	golang.org/x/text v0.25.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -12,6 +12,7 @@ type PageReturn struct {
 	URL               string
 	StatusCode        int
 	DelayMilliseconds time.Duration
+	Headers           map[string]string
 }
 
 func startTestServerPages(pages []PageReturn) *httptest.Server {
@@ -20,6 +21,9 @@ func startTestServerPages(pages []PageReturn) *httptest.Server {
 	lo.ForEach(pages, func(page PageReturn, _ int) {
 		handler.HandleFunc(page.URL, func(w http.ResponseWriter, r *http.Request) {
 			time.Sleep(page.DelayMilliseconds * time.Millisecond)
+			for key, value := range page.Headers {
+				w.Header().Set(key, value)
+			}
 			w.WriteHeader(page.StatusCode)
 			w.Write([]byte(page.HTML))
 		})
@@ -14,13 +14,13 @@ type URLLoggingWithLinksPostProcessor struct {
 	LinksFound     atomic.Int64
 }
 
-func (s *URLLoggingWithLinksPostProcessor) Process(ctx context.Context, pageURL *url.URL, pageContent string) error {
-	log.Printf("URLLoggingWithLinksPostProcessor processing page: %s", pageURL.String())
-	urls, err := ExtractLinks(pageContent)
+func (s *URLLoggingWithLinksPostProcessor) Process(ctx context.Context, page *CrawledPage) error {
+	log.Printf("URLLoggingWithLinksPostProcessor processing page: %s (%d, %s)", page.URL.String(), page.Result.StatusCode, page.Result.Duration)
+	urls, err := ExtractLinks(page.Result.Body)
 	if err != nil {
 		return err
 	}
-	s.URLsCrawled.Store(pageURL.String(), urls)
+	s.URLsCrawled.Store(page.URL.String(), urls)
 	s.PagesProcessed.Add(1)
 	s.LinksFound.Add(int64(len(urls)))
 	return nil
@@ -39,6 +39,7 @@ func main() {
 		"Mozilla/5.0 (compatible; JakeBot/1.0; +https://jakesaunders.dev/bot)",
 		2,
 		[]PostProcessor{processor},
+		nil,
 	)
 	if err != nil {
 		logger.Error("Failed to create site crawler: %v", err)
@@ -2,43 +2,223 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
+	"time"
 )
 
+// Fetcher retrieves the content of a page. SiteCrawler depends on this interface rather than on net/http directly so
+// that the transport can be tuned, decorated or swapped for a fake in tests.
+type Fetcher interface {
+	FetchPage(ctx context.Context, pageURL *url.URL) (*FetchResult, error)
+}
+
+// ConditionalFetcher is a Fetcher that can revalidate a page it has fetched before. The crawler uses it in recrawl
+// mode when the Fetcher supports it.
+type ConditionalFetcher interface {
+	Fetcher
+	// FetchPageConditional fetches a page, sending If-None-Match and If-Modified-Since from the given validators.
+	// A 304 Not Modified response is returned as a FetchResult with an empty body rather than as an error.
+	FetchPageConditional(ctx context.Context, pageURL *url.URL, validators Validators) (*FetchResult, error)
+}
+
+// StreamingFetcher is a Fetcher that can hand over a response body as it arrives rather than reading it into memory.
+// The crawler uses it for sitemaps when the Fetcher supports it, so they are parsed as they download.
+type StreamingFetcher interface {
+	Fetcher
+	// FetchStream fetches a page and returns its body unread; the caller must close it. The FetchResult has no Body
+	// or ContentLength, and its Duration only covers the time to the response headers.
+	FetchStream(ctx context.Context, pageURL *url.URL) (*FetchResult, io.ReadCloser, error)
+}
+
+// FetchResult is everything we learned about a page from fetching it.
+type FetchResult struct {
+	URL           *url.URL // URL that was requested
+	FinalURL      *url.URL // URL the content was served from, after following redirects
+	StatusCode    int
+	Header        http.Header
+	ContentType   string
+	ContentLength int64 // Number of body bytes received
+	Body          string
+	Duration      time.Duration // Time from sending the request to reading the full body
+	Attempts      int           // Number of attempts it took to fetch the page, set by the crawler's retry policy
+}
+
+// HTTPFetcherConfig holds the tunables for the long-lived transport behind an HTTPFetcher.
+type HTTPFetcherConfig struct {
+	UserAgent           string
+	Proxy               func(*http.Request) (*url.URL, error)
+	TLSClientConfig     *tls.Config
+	DialTimeout         time.Duration
+	TLSHandshakeTimeout time.Duration
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	MaxConnsPerHost     int
+	IdleConnTimeout     time.Duration
+	MaxRedirects        int // Redirects followed before giving up; 0 means defaultMaxRedirects, like http.Client
+}
+
+// defaultMaxRedirects is how many redirects are followed when MaxRedirects is 0, matching http.Client.
+const defaultMaxRedirects = 10
+
+// DefaultHTTPFetcherConfig returns a config suitable for crawling a handful of hosts concurrently.
+func DefaultHTTPFetcherConfig() HTTPFetcherConfig {
+	return HTTPFetcherConfig{
+		Proxy:               http.ProxyFromEnvironment,
+		DialTimeout:         30 * time.Second,
+		TLSHandshakeTimeout: 10 * time.Second,
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 20,
+		IdleConnTimeout:     90 * time.Second,
+		MaxRedirects:        defaultMaxRedirects,
+	}
+}
+
+// HTTPFetcher is the default Fetcher. It shares a single http.Client (and therefore a single connection pool) between
+// all requests, so it should be created once and reused for the lifetime of a crawl.
+type HTTPFetcher struct {
+	client    *http.Client
+	userAgent string
+}
+
+// NewHTTPFetcher creates an HTTPFetcher whose transport is built from the given config.
+func NewHTTPFetcher(config HTTPFetcherConfig) *HTTPFetcher {
+	transport := &http.Transport{
+		Proxy: config.Proxy,
+		DialContext: (&net.Dialer{
+			Timeout:   config.DialTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSClientConfig:     config.TLSClientConfig,
+		TLSHandshakeTimeout: config.TLSHandshakeTimeout,
+		MaxIdleConns:        config.MaxIdleConns,
+		MaxIdleConnsPerHost: config.MaxIdleConnsPerHost,
+		MaxConnsPerHost:     config.MaxConnsPerHost,
+		IdleConnTimeout:     config.IdleConnTimeout,
+		ForceAttemptHTTP2:   true,
+	}
+	maxRedirects := config.MaxRedirects
+	if maxRedirects <= 0 {
+		maxRedirects = defaultMaxRedirects
+	}
+	return &HTTPFetcher{
+		client: &http.Client{
+			Transport: transport,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) >= maxRedirects {
+					return errors.New("stopped after too many redirects")
+				}
+				return nil
+			},
+		},
+		userAgent: config.UserAgent,
+	}
+}
+
 // FetchPage fetches the HTML content of a given page.
 // It expects a 2XX response, returning an error if the page is unreachable.
-func FetchPage(ctx context.Context, url *url.URL) (string, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url.String(), nil)
+func (f *HTTPFetcher) FetchPage(ctx context.Context, url *url.URL) (*FetchResult, error) {
+	return f.FetchPageConditional(ctx, url, Validators{})
+}
+
+// FetchPageConditional fetches a page like FetchPage, but asks the server to answer 304 Not Modified if it still
+// matches the given validators.
+func (f *HTTPFetcher) FetchPageConditional(ctx context.Context, url *url.URL, validators Validators) (*FetchResult, error) {
+	start := time.Now()
+	resp, err := f.do(ctx, url, validators)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
+	defer resp.Body.Close()
 
-	client := http.Client{}
+	if resp.StatusCode == http.StatusNotModified && validators.conditional() {
+		return &FetchResult{
+			URL:         url,
+			FinalURL:    resp.Request.URL,
+			StatusCode:  resp.StatusCode,
+			Header:      resp.Header,
+			ContentType: resp.Header.Get("Content-Type"),
+			Duration:    time.Since(start),
+		}, nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, &httpError{StatusCode: resp.StatusCode, URL: url.String(), Header: resp.Header}
+	}
 
-	resp, err := client.Do(req)
+	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	defer resp.Body.Close()
 
+	return &FetchResult{
+		URL:           url,
+		FinalURL:      resp.Request.URL,
+		StatusCode:    resp.StatusCode,
+		Header:        resp.Header,
+		ContentType:   resp.Header.Get("Content-Type"),
+		ContentLength: int64(len(body)),
+		Body:          string(body),
+		Duration:      time.Since(start),
+	}, nil
+}
+
+// FetchStream fetches a page like FetchPage, but returns its body unread so that it can be parsed as it arrives.
+// Bodies sent with Content-Encoding: gzip are decompressed as they are read.
+func (f *HTTPFetcher) FetchStream(ctx context.Context, url *url.URL) (*FetchResult, io.ReadCloser, error) {
+	start := time.Now()
+	resp, err := f.do(ctx, url, Validators{})
+	if err != nil {
+		return nil, nil, err
+	}
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return "", &httpError{StatusCode: resp.StatusCode, URL: url.String()}
+		resp.Body.Close()
+		return nil, nil, &httpError{StatusCode: resp.StatusCode, URL: url.String(), Header: resp.Header}
 	}
+	return &FetchResult{
+		URL:         url,
+		FinalURL:    resp.Request.URL,
+		StatusCode:  resp.StatusCode,
+		Header:      resp.Header,
+		ContentType: resp.Header.Get("Content-Type"),
+		Duration:    time.Since(start),
+	}, resp.Body, nil
+}
 
-	body, err := io.ReadAll(resp.Body)
+// do sends a GET request for url with the fetcher's user agent and any conditional headers from validators.
+func (f *HTTPFetcher) do(ctx context.Context, url *url.URL, validators Validators) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url.String(), nil)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
+	if f.userAgent != "" {
+		req.Header.Set("User-Agent", f.userAgent)
+	}
+	if validators.ETag != "" {
+		req.Header.Set("If-None-Match", validators.ETag)
+	}
+	if validators.LastModified != "" {
+		req.Header.Set("If-Modified-Since", validators.LastModified)
+	}
+	return f.client.Do(req)
+}
+
+// defaultFetcher backs the package level FetchPage helper.
+var defaultFetcher = NewHTTPFetcher(DefaultHTTPFetcherConfig())
 
-	return string(body), nil
+// FetchPage fetches a page using a shared HTTPFetcher with the default config.
+func FetchPage(ctx context.Context, url *url.URL) (*FetchResult, error) {
+	return defaultFetcher.FetchPage(ctx, url)
 }
 
 // httpError represents an error that occurs when an HTTP request fails with a non-2XX status code.
 type httpError struct {
 	StatusCode int
 	URL        string
+	Header     http.Header
 }
 
 // Error implements the error interface for httpError.
@@ -4,9 +4,12 @@ import (
 	"context"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -37,9 +40,9 @@ func TestFetchPage_Success_ReturnsBody(t *testing.T) {
 	defer server.Close()
 
 	serverUrl, _ := url.Parse(server.URL)
-	content, err := FetchPage(context.Background(), serverUrl)
+	result, err := FetchPage(context.Background(), serverUrl)
 	require.NoError(t, err)
-	assert.Equal(t, "<html><body>Test Page</body></html>", content)
+	assert.Equal(t, "<html><body>Test Page</body></html>", result.Body)
 }
 
 func TestFetchPage_ReturnsError_Timeout(t *testing.T) {
@@ -48,7 +51,8 @@ func TestFetchPage_ReturnsError_Timeout(t *testing.T) {
 	defer server.Close()
 
 	serverUrl, _ := url.Parse(server.URL)
-	ctx, _ := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
 	_, err := FetchPage(ctx, serverUrl)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "context deadline exceeded")
@@ -79,3 +83,181 @@ func TestFetchPage_ReturnsError_InvalidURL(t *testing.T) {
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "no such host")
 }
+
+func TestHTTPFetcher_SendsConfiguredUserAgent(t *testing.T) {
+	t.Parallel()
+	var userAgent atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent.Store(r.UserAgent())
+	}))
+	defer server.Close()
+
+	config := DefaultHTTPFetcherConfig()
+	config.UserAgent = "TestBot/1.0"
+	fetcher := NewHTTPFetcher(config)
+
+	serverUrl, _ := url.Parse(server.URL)
+	_, err := fetcher.FetchPage(context.Background(), serverUrl)
+	require.NoError(t, err)
+	assert.Equal(t, "TestBot/1.0", userAgent.Load())
+}
+
+func TestHTTPFetcher_ReusesConnectionsBetweenRequests(t *testing.T) {
+	t.Parallel()
+	var newConnections atomic.Int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			newConnections.Add(1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	fetcher := NewHTTPFetcher(DefaultHTTPFetcherConfig())
+	serverUrl, _ := url.Parse(server.URL)
+	for i := 0; i < 5; i++ {
+		_, err := fetcher.FetchPage(context.Background(), serverUrl)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, int32(1), newConnections.Load())
+}
+
+func TestFetchPage_Success_ReturnsResponseMetadata(t *testing.T) {
+	t.Parallel()
+	server := startTestServerPages([]PageReturn{
+		{
+			URL:        "/page",
+			HTML:       "<html><body>Test Page</body></html>",
+			StatusCode: http.StatusOK,
+			Headers: map[string]string{
+				"Content-Type":  "text/html; charset=utf-8",
+				"Last-Modified": "Wed, 21 Oct 2015 07:28:00 GMT",
+			},
+		},
+	})
+	defer server.Close()
+
+	pageUrl, _ := url.Parse(server.URL + "/page")
+	result, err := FetchPage(context.Background(), pageUrl)
+	require.NoError(t, err)
+	assert.Equal(t, pageUrl, result.URL)
+	assert.Equal(t, pageUrl.String(), result.FinalURL.String())
+	assert.Equal(t, http.StatusOK, result.StatusCode)
+	assert.Equal(t, "text/html; charset=utf-8", result.ContentType)
+	assert.Equal(t, "Wed, 21 Oct 2015 07:28:00 GMT", result.Header.Get("Last-Modified"))
+	assert.Equal(t, int64(len("<html><body>Test Page</body></html>")), result.ContentLength)
+	assert.Greater(t, result.Duration, time.Duration(0))
+}
+
+func TestFetchPage_Success_ReportsFinalURLAfterRedirect(t *testing.T) {
+	t.Parallel()
+	handler := http.NewServeMux()
+	handler.Handle("/old", http.RedirectHandler("/new", http.StatusMovedPermanently))
+	handler.HandleFunc("/new", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("moved"))
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	oldUrl, _ := url.Parse(server.URL + "/old")
+	result, err := FetchPage(context.Background(), oldUrl)
+	require.NoError(t, err)
+	assert.Equal(t, server.URL+"/old", result.URL.String())
+	assert.Equal(t, server.URL+"/new", result.FinalURL.String())
+	assert.Equal(t, "moved", result.Body)
+}
+
+func TestHTTPFetcher_ZeroConfig_FollowsRedirects(t *testing.T) {
+	t.Parallel()
+	handler := http.NewServeMux()
+	handler.Handle("/old", http.RedirectHandler("/new", http.StatusMovedPermanently))
+	handler.HandleFunc("/new", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("moved"))
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	oldUrl, _ := url.Parse(server.URL + "/old")
+	result, err := NewHTTPFetcher(HTTPFetcherConfig{}).FetchPage(context.Background(), oldUrl)
+	require.NoError(t, err)
+	assert.Equal(t, server.URL+"/new", result.FinalURL.String())
+}
+
+func TestHTTPFetcher_FetchStream_ReturnsUnreadBody(t *testing.T) {
+	t.Parallel()
+	server := startTestServer("<urlset></urlset>", http.StatusOK, 0)
+	defer server.Close()
+
+	serverUrl, _ := url.Parse(server.URL)
+	result, body, err := NewHTTPFetcher(DefaultHTTPFetcherConfig()).FetchStream(context.Background(), serverUrl)
+	require.NoError(t, err)
+	defer body.Close()
+	assert.Equal(t, http.StatusOK, result.StatusCode)
+	assert.Empty(t, result.Body)
+	content, err := io.ReadAll(body)
+	require.NoError(t, err)
+	assert.Equal(t, "<urlset></urlset>", string(content))
+}
+
+func TestHTTPFetcher_FetchStream_ReturnsError_Non2XXStatus(t *testing.T) {
+	t.Parallel()
+	server := startTestServer("", http.StatusNotFound, 0)
+	defer server.Close()
+
+	serverUrl, _ := url.Parse(server.URL)
+	_, _, err := NewHTTPFetcher(DefaultHTTPFetcherConfig()).FetchStream(context.Background(), serverUrl)
+	var httpErr *httpError
+	require.ErrorAs(t, err, &httpErr)
+	assert.Equal(t, http.StatusNotFound, httpErr.StatusCode)
+}
+
+func TestHTTPFetcher_FetchPageConditional_ReturnsNotModified(t *testing.T) {
+	t.Parallel()
+	var ifNoneMatch, ifModifiedSince atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ifNoneMatch.Store(r.Header.Get("If-None-Match"))
+		ifModifiedSince.Store(r.Header.Get("If-Modified-Since"))
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte("Beans"))
+	}))
+	defer server.Close()
+
+	serverUrl, _ := url.Parse(server.URL)
+	fetcher := NewHTTPFetcher(DefaultHTTPFetcherConfig())
+	result, err := fetcher.FetchPageConditional(context.Background(), serverUrl, Validators{
+		ETag:         `"v1"`,
+		LastModified: "Mon, 01 Jan 2024 00:00:00 GMT",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotModified, result.StatusCode)
+	assert.Empty(t, result.Body)
+	assert.Equal(t, `"v1"`, ifNoneMatch.Load())
+	assert.Equal(t, "Mon, 01 Jan 2024 00:00:00 GMT", ifModifiedSince.Load())
+
+	result, err = fetcher.FetchPageConditional(context.Background(), serverUrl, Validators{ETag: `"v0"`})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, result.StatusCode)
+	assert.Equal(t, "Beans", result.Body)
+}
+
+func TestHTTPFetcher_FetchPage_SendsNoConditionalHeaders(t *testing.T) {
+	t.Parallel()
+	var conditional atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conditional.Store(r.Header.Get("If-None-Match") != "" || r.Header.Get("If-Modified-Since") != "")
+		w.Write([]byte("Beans"))
+	}))
+	defer server.Close()
+
+	serverUrl, _ := url.Parse(server.URL)
+	_, err := NewHTTPFetcher(DefaultHTTPFetcherConfig()).FetchPage(context.Background(), serverUrl)
+	require.NoError(t, err)
+	assert.False(t, conditional.Load())
+}
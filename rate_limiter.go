@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimit is a token-bucket rate: a steady number of requests per second plus a burst allowance.
+// A zero RequestsPerSecond means unlimited.
+type RateLimit struct {
+	RequestsPerSecond float64
+	Burst             int
+}
+
+// RateLimitFromCrawlDelay converts a robots.txt Crawl-delay into the equivalent RateLimit.
+func RateLimitFromCrawlDelay(delay time.Duration) RateLimit {
+	if delay <= 0 {
+		return RateLimit{}
+	}
+	return RateLimit{RequestsPerSecond: float64(time.Second) / float64(delay), Burst: 1}
+}
+
+// HostRateLimiter keeps a token bucket per host. Every host is limited by Limit when it is set, otherwise by the
+// Crawl-delay registered for it with SetCrawlDelay, otherwise not at all.
+type HostRateLimiter struct {
+	Limit RateLimit
+
+	mu          sync.Mutex
+	buckets     map[string]*tokenBucket
+	crawlDelays map[string]time.Duration
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewHostRateLimiter creates a HostRateLimiter applying limit to every host.
+func NewHostRateLimiter(limit RateLimit) *HostRateLimiter {
+	return &HostRateLimiter{
+		Limit:       limit,
+		buckets:     make(map[string]*tokenBucket),
+		crawlDelays: make(map[string]time.Duration),
+	}
+}
+
+// SetCrawlDelay registers the robots.txt Crawl-delay for host, used when no explicit Limit is configured.
+func (l *HostRateLimiter) SetCrawlDelay(host string, delay time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.crawlDelays[host] = delay
+}
+
+// LimitFor returns the rate limit that applies to host.
+func (l *HostRateLimiter) LimitFor(host string) RateLimit {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limitFor(host)
+}
+
+// Wait blocks until a request to host is allowed, or until ctx is done.
+func (l *HostRateLimiter) Wait(ctx context.Context, host string) error {
+	wait := l.reserve(host)
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// reserve takes a token from the host's bucket, returning how long the caller must wait before it can be used.
+// Tokens can go negative so that concurrent callers queue up behind each other instead of all waking at once.
+func (l *HostRateLimiter) reserve(host string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	limit := l.limitFor(host)
+	if limit.RequestsPerSecond <= 0 {
+		return 0
+	}
+	burst := float64(max(limit.Burst, 1))
+	now := time.Now()
+	bucket, ok := l.buckets[host]
+	if !ok {
+		bucket = &tokenBucket{tokens: burst, last: now}
+		l.buckets[host] = bucket
+	}
+	bucket.tokens = min(bucket.tokens+now.Sub(bucket.last).Seconds()*limit.RequestsPerSecond, burst)
+	bucket.last = now
+	bucket.tokens--
+	if bucket.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-bucket.tokens / limit.RequestsPerSecond * float64(time.Second))
+}
+
+// limitFor resolves the limit for host. The caller must hold l.mu.
+func (l *HostRateLimiter) limitFor(host string) RateLimit {
+	if l.Limit.RequestsPerSecond > 0 {
+		return l.Limit
+	}
+	return RateLimitFromCrawlDelay(l.crawlDelays[host])
+}
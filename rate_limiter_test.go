@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestRateLimitFromCrawlDelay(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, RateLimit{RequestsPerSecond: 0.5, Burst: 1}, RateLimitFromCrawlDelay(2*time.Second))
+	assert.Equal(t, RateLimit{RequestsPerSecond: 4, Burst: 1}, RateLimitFromCrawlDelay(250*time.Millisecond))
+	assert.Equal(t, RateLimit{}, RateLimitFromCrawlDelay(0))
+}
+
+func TestHostRateLimiter_UnlimitedByDefault(t *testing.T) {
+	t.Parallel()
+	limiter := NewHostRateLimiter(RateLimit{})
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		require.NoError(t, limiter.Wait(context.Background(), "example.com"))
+	}
+	assert.Less(t, time.Since(start), 50*time.Millisecond)
+}
+
+func TestHostRateLimiter_AllowsBurstThenPaces(t *testing.T) {
+	t.Parallel()
+	limiter := NewHostRateLimiter(RateLimit{RequestsPerSecond: 20, Burst: 3})
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		require.NoError(t, limiter.Wait(context.Background(), "example.com"))
+	}
+	assert.Less(t, time.Since(start), 25*time.Millisecond, "burst should not be delayed")
+
+	for i := 0; i < 4; i++ {
+		require.NoError(t, limiter.Wait(context.Background(), "example.com"))
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 180*time.Millisecond, "requests beyond the burst are paced")
+}
+
+func TestHostRateLimiter_BucketsArePerHost(t *testing.T) {
+	t.Parallel()
+	limiter := NewHostRateLimiter(RateLimit{RequestsPerSecond: 1, Burst: 1})
+	start := time.Now()
+	require.NoError(t, limiter.Wait(context.Background(), "a.example.com"))
+	require.NoError(t, limiter.Wait(context.Background(), "b.example.com"))
+	assert.Less(t, time.Since(start), 50*time.Millisecond)
+}
+
+func TestHostRateLimiter_FallsBackToCrawlDelay(t *testing.T) {
+	t.Parallel()
+	limiter := NewHostRateLimiter(RateLimit{})
+	limiter.SetCrawlDelay("example.com", 100*time.Millisecond)
+	assert.Equal(t, RateLimit{RequestsPerSecond: 10, Burst: 1}, limiter.LimitFor("example.com"))
+	assert.Equal(t, RateLimit{}, limiter.LimitFor("other.com"))
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		require.NoError(t, limiter.Wait(context.Background(), "example.com"))
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 180*time.Millisecond)
+
+	limiter.Limit = RateLimit{RequestsPerSecond: 100, Burst: 5}
+	assert.Equal(t, RateLimit{RequestsPerSecond: 100, Burst: 5}, limiter.LimitFor("example.com"), "explicit limit overrides crawl delay")
+}
+
+func TestHostRateLimiter_WaitRespectsContextCancellation(t *testing.T) {
+	t.Parallel()
+	limiter := NewHostRateLimiter(RateLimit{RequestsPerSecond: 0.1, Burst: 1})
+	require.NoError(t, limiter.Wait(context.Background(), "example.com"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, limiter.Wait(ctx, "example.com"), context.DeadlineExceeded)
+}
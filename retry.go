@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"math/rand/v2"
+	"net"
+	"slices"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy controls how the crawler retries fetches that fail for transient reasons.
+type RetryPolicy struct {
+	MaxAttempts          int           // Total attempts including the first; values below 1 mean a single attempt
+	BaseDelay            time.Duration // Delay before the first retry, doubled on every subsequent retry
+	MaxDelay             time.Duration // Upper bound for the delay between attempts
+	Jitter               float64       // Fraction (0-1) of each delay that is randomised to avoid thundering herds
+	RetryableStatusCodes []int         // httpError status codes that are worth retrying
+	RetryNetworkErrors   bool          // Retry timeouts, connection resets and other transient network failures
+}
+
+// DefaultRetryPolicy returns a policy that retries common transient failures twice with a short backoff.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   500 * time.Millisecond,
+		MaxDelay:    10 * time.Second,
+		Jitter:      0.5,
+		RetryableStatusCodes: []int{
+			408, // Request Timeout
+			429, // Too Many Requests
+			500, // Internal Server Error
+			502, // Bad Gateway
+			503, // Service Unavailable
+			504, // Gateway Timeout
+		},
+		RetryNetworkErrors: true,
+	}
+}
+
+// IsRetryable reports whether err is a failure this policy considers transient.
+func (p RetryPolicy) IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var httpErr *httpError
+	if errors.As(err, &httpErr) {
+		return slices.Contains(p.RetryableStatusCodes, httpErr.StatusCode)
+	}
+	if !p.RetryNetworkErrors {
+		return false
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+	// Every error from http.Client.Do is a *url.Error, which is a net.Error, so only timeouts and failures to
+	// connect or read are treated as transient. TLS, redirect and scheme errors won't go away by trying again.
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && (opErr.Op == "dial" || opErr.Op == "read")
+}
+
+// Backoff returns how long to wait after the given (1-based) failed attempt before trying again.
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	delay := float64(p.BaseDelay) * math.Pow(2, float64(attempt-1))
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+	if p.Jitter > 0 {
+		jitter := math.Min(p.Jitter, 1)
+		delay = delay*(1-jitter) + rand.Float64()*delay*jitter
+	}
+	return time.Duration(delay)
+}
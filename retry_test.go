@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy_IsRetryable(t *testing.T) {
+	t.Parallel()
+	policy := DefaultRetryPolicy()
+
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{name: "nil error", err: nil, expected: false},
+		{name: "503 response", err: &httpError{StatusCode: 503}, expected: true},
+		{name: "429 response", err: &httpError{StatusCode: 429}, expected: true},
+		{name: "404 response", err: &httpError{StatusCode: 404}, expected: false},
+		{name: "attempt timeout", err: fmt.Errorf("get: %w", context.DeadlineExceeded), expected: true},
+		{name: "cancelled", err: fmt.Errorf("get: %w", context.Canceled), expected: false},
+		{name: "connection reset", err: &net.OpError{Op: "read", Err: syscall.ECONNRESET}, expected: true},
+		{name: "truncated body", err: io.ErrUnexpectedEOF, expected: true},
+		{name: "unknown host", err: &net.DNSError{Err: "no such host", IsNotFound: true}, expected: false},
+		{name: "other error", err: fmt.Errorf("boom"), expected: false},
+		{name: "dial failure", err: &url.Error{Op: "Get", URL: "https://example.com/", Err: &net.OpError{Op: "dial", Err: errors.New("no route to host")}}, expected: true},
+		{name: "network timeout", err: &url.Error{Op: "Get", URL: "https://example.com/", Err: &net.OpError{Op: "write", Err: os.ErrDeadlineExceeded}}, expected: true},
+		{name: "untrusted certificate", err: &url.Error{Op: "Get", URL: "https://example.com/", Err: &tls.CertificateVerificationError{Err: x509.UnknownAuthorityError{}}}, expected: false},
+		{name: "unsupported scheme", err: &url.Error{Op: "Get", URL: "ftp://example.com/", Err: errors.New(`unsupported protocol scheme "ftp"`)}, expected: false},
+		{name: "redirect loop", err: &url.Error{Op: "Get", URL: "https://example.com/", Err: errors.New("stopped after too many redirects")}, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, policy.IsRetryable(tt.err))
+		})
+	}
+}
+
+func TestRetryPolicy_IsRetryable_NetworkErrorsCanBeDisabled(t *testing.T) {
+	t.Parallel()
+	policy := DefaultRetryPolicy()
+	policy.RetryNetworkErrors = false
+	assert.False(t, policy.IsRetryable(io.ErrUnexpectedEOF))
+	assert.True(t, policy.IsRetryable(&httpError{StatusCode: 503}))
+}
+
+func TestRetryPolicy_Backoff_DoublesUpToMaxDelay(t *testing.T) {
+	t.Parallel()
+	policy := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	assert.Equal(t, 100*time.Millisecond, policy.Backoff(1))
+	assert.Equal(t, 200*time.Millisecond, policy.Backoff(2))
+	assert.Equal(t, 400*time.Millisecond, policy.Backoff(3))
+	assert.Equal(t, time.Second, policy.Backoff(10))
+}
+
+func TestRetryPolicy_Backoff_JitterStaysWithinBounds(t *testing.T) {
+	t.Parallel()
+	policy := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second, Jitter: 0.5}
+	for i := 0; i < 100; i++ {
+		delay := policy.Backoff(2)
+		assert.GreaterOrEqual(t, delay, 100*time.Millisecond)
+		assert.LessOrEqual(t, delay, 200*time.Millisecond)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultRobotsTTL      = 24 * time.Hour // How long a fetched robots.txt is used before it is fetched again
+	DefaultRobotsErrorTTL = time.Minute    // How long an unavailable robots.txt disallows a host before it is retried
+)
+
+// hostRobots is the cached robots.txt for one scheme, host and port.
+type hostRobots struct {
+	mu          sync.Mutex
+	checker     *RobotsChecker
+	fetchedAt   time.Time
+	unavailable bool // The robots.txt couldn't be fetched, so the host is disallowed until it is retried
+}
+
+// robotsKey identifies the robots.txt that applies to a URL. Each scheme, host and port has its own, and a URL
+// without a port shares the robots.txt of the scheme's default port.
+func robotsKey(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		switch u.Scheme {
+		case "http":
+			port = "80"
+		case "https":
+			port = "443"
+		}
+	}
+	return u.Scheme + "://" + net.JoinHostPort(u.Hostname(), port)
+}
+
+// hostRobots returns the robots.txt checker for the URL's host, fetching and parsing robots.txt the first time the
+// host is seen and again once the cached copy expires. Concurrent lookups for the same host wait for a single fetch.
+func (sc *SiteCrawler) hostRobots(ctx context.Context, u *url.URL) (*RobotsChecker, error) {
+	entry, _ := sc.robots.LoadOrStore(robotsKey(u), &hostRobots{})
+	robots := entry.(*hostRobots)
+	robots.mu.Lock()
+	defer robots.mu.Unlock()
+	ttl := sc.RobotsTTL
+	if robots.unavailable {
+		ttl = sc.RobotsErrorTTL
+	}
+	if robots.checker != nil && time.Since(robots.fetchedAt) < ttl {
+		return robots.checker, nil
+	}
+	checker, unavailable, err := sc.loadRobots(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	robots.checker, robots.fetchedAt, robots.unavailable = checker, time.Now(), unavailable
+	return checker, nil
+}
+
+// robotsFor returns the robots.txt checker for the URL's host. If the host's robots.txt can't be parsed everything on
+// the host is allowed.
+func (sc *SiteCrawler) robotsFor(ctx context.Context, u *url.URL) *RobotsChecker {
+	checker, err := sc.hostRobots(ctx, u)
+	if err != nil {
+		sc.Logger.Warn("Failed to parse robots.txt for %s, allowing everything: %v", u.Host, err)
+		checker, _ = NewRobotsChecker("")
+	}
+	return checker
+}
+
+// loadRobots fetches and parses the robots.txt for the URL's host, following redirects, and applies its Crawl-delay
+// to the host's rate limit. It also reports whether the robots.txt was unavailable, in which case the checker
+// disallows the whole host.
+func (sc *SiteCrawler) loadRobots(ctx context.Context, u *url.URL) (*RobotsChecker, bool, error) {
+	robotsUrl, err := u.Parse("/robots.txt")
+	if err != nil {
+		return nil, false, err
+	}
+	robots, err := sc.fetch(ctx, robotsUrl, Validators{})
+	statusCode, robotsTxt := robotsResponse(robots, err)
+	robotsChecker, err := NewRobotsCheckerFromStatus(statusCode, robotsTxt)
+	if err != nil {
+		return nil, false, err
+	}
+	if statusCode >= 500 {
+		sc.Logger.Warn("robots.txt for %s is unavailable, disallowing the host for %s", u.Host, sc.RobotsErrorTTL)
+		return robotsChecker, true, nil
+	}
+	// Set even when there is no Crawl-delay, so that one dropped from a refetched robots.txt stops applying
+	delay := robotsChecker.CrawlDelay(sc.UserAgent)
+	if delay > 0 {
+		sc.Logger.Debug("Using robots.txt Crawl-delay of %s for %s", delay, u.Host)
+	}
+	sc.RateLimiter.SetCrawlDelay(u.Host, delay)
+	return robotsChecker, false, nil
+}
+
+// robotsResponse returns the status code and body to build a robots.txt checker from. Network errors and 429 Too Many
+// Requests are treated like a 5XX, as the robots.txt may exist but couldn't be read.
+func robotsResponse(result *FetchResult, err error) (int, string) {
+	if err == nil {
+		return result.StatusCode, result.Body
+	}
+	var httpErr *httpError
+	if errors.As(err, &httpErr) && httpErr.StatusCode != http.StatusTooManyRequests {
+		return httpErr.StatusCode, ""
+	}
+	return http.StatusServiceUnavailable, ""
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// robotsFetcher serves robots.txt with a status code that can be changed between fetches, and counts the fetches.
+type robotsFetcher struct {
+	status  atomic.Int32
+	body    string
+	err     error
+	fetches atomic.Int32
+}
+
+func (f *robotsFetcher) FetchPage(ctx context.Context, pageURL *url.URL) (*FetchResult, error) {
+	f.fetches.Add(1)
+	if f.err != nil {
+		return nil, f.err
+	}
+	status := int(f.status.Load())
+	if status < 200 || status >= 300 {
+		return nil, &httpError{StatusCode: status, URL: pageURL.String()}
+	}
+	return &FetchResult{URL: pageURL, FinalURL: pageURL, StatusCode: status, Body: f.body, ContentLength: int64(len(f.body))}, nil
+}
+
+// newRobotsTestCrawler creates a crawler for example.com without retries. The fetcher is used to fetch example.com's
+// robots.txt during construction, so tests look up other hosts, or expire the cache, to see their own responses.
+func newRobotsTestCrawler(t *testing.T, fetcher Fetcher) *SiteCrawler {
+	t.Helper()
+	crawler, err := NewSiteCrawler(context.Background(), *mustParse(t, "https://example.com/"), &StdoutLogger{}, 1000, "Crawler", 1, nil, fetcher)
+	require.NoError(t, err)
+	crawler.RetryPolicy.MaxAttempts = 1
+	crawler.Scope = Scope{Mode: ScopeRegistrableDomain}
+	return crawler
+}
+
+func TestSiteCrawler_Robots_FetchFailureSemantics(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		err    error
+		queued int
+	}{
+		{name: "disallow rule", status: http.StatusOK, queued: 1},
+		{name: "not found allows everything", status: http.StatusNotFound, queued: 2},
+		{name: "forbidden allows everything", status: http.StatusForbidden, queued: 2},
+		{name: "server error disallows everything", status: http.StatusInternalServerError, queued: 0},
+		{name: "too many requests disallows everything", status: http.StatusTooManyRequests, queued: 0},
+		{name: "network error disallows everything", err: errors.New("connection refused"), queued: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			fetcher := &robotsFetcher{}
+			fetcher.status.Store(http.StatusNotFound)
+			crawler := newRobotsTestCrawler(t, fetcher)
+			fetcher.body, fetcher.err = "User-agent: *\nDisallow: /private", tt.err
+			fetcher.status.Store(int32(tt.status))
+
+			crawler.AddURLToCrawlQueue(context.Background(), FrontierItem{URL: "https://www.example.com/private?page=2"})
+			crawler.AddURLToCrawlQueue(context.Background(), FrontierItem{URL: "https://www.example.com/public"})
+
+			assert.Equal(t, tt.queued, crawler.Frontier.Len())
+			assert.Equal(t, int64(2-tt.queued), crawler.Stats.Snapshot().Skipped[SkipRobots])
+		})
+	}
+}
+
+func TestSiteCrawler_Robots_RefetchesAfterTTL(t *testing.T) {
+	fetcher := &robotsFetcher{body: "User-agent: *\nAllow: /"}
+	fetcher.status.Store(http.StatusOK)
+	crawler := newRobotsTestCrawler(t, fetcher)
+	crawler.RobotsTTL = 50 * time.Millisecond
+	page := mustParse(t, "https://example.com/page")
+
+	crawler.robotsFor(context.Background(), page)
+	assert.Equal(t, int32(1), fetcher.fetches.Load(), "robots.txt should be cached from construction")
+
+	time.Sleep(60 * time.Millisecond)
+	crawler.robotsFor(context.Background(), page)
+	crawler.robotsFor(context.Background(), page)
+	assert.Equal(t, int32(2), fetcher.fetches.Load())
+}
+
+func TestSiteCrawler_Robots_ClearsCrawlDelayRemovedFromRefetchedRobots(t *testing.T) {
+	fetcher := &robotsFetcher{body: "User-agent: *\nCrawl-delay: 2"}
+	fetcher.status.Store(http.StatusOK)
+	crawler := newRobotsTestCrawler(t, fetcher)
+	crawler.RobotsTTL = 50 * time.Millisecond
+	assert.Equal(t, RateLimitFromCrawlDelay(2*time.Second), crawler.RateLimiter.LimitFor("example.com"))
+
+	fetcher.body = "User-agent: *\nAllow: /"
+	time.Sleep(60 * time.Millisecond)
+	crawler.robotsFor(context.Background(), mustParse(t, "https://example.com/page"))
+	assert.Equal(t, RateLimit{}, crawler.RateLimiter.LimitFor("example.com"))
+}
+
+func TestSiteCrawler_Robots_RetriesUnavailableRobotsAfterErrorTTL(t *testing.T) {
+	fetcher := &robotsFetcher{body: "User-agent: *\nAllow: /"}
+	fetcher.status.Store(http.StatusOK)
+	crawler := newRobotsTestCrawler(t, fetcher)
+	crawler.RobotsTTL = 0
+	crawler.RobotsErrorTTL = 50 * time.Millisecond
+	fetcher.status.Store(http.StatusServiceUnavailable)
+	page := mustParse(t, "https://example.com/page")
+	assert.False(t, crawler.robotsFor(context.Background(), page).IsAllowed(page.RequestURI(), "Crawler"))
+
+	fetcher.status.Store(http.StatusOK)
+	assert.False(t, crawler.robotsFor(context.Background(), page).IsAllowed(page.RequestURI(), "Crawler"))
+	time.Sleep(60 * time.Millisecond)
+	assert.True(t, crawler.robotsFor(context.Background(), page).IsAllowed(page.RequestURI(), "Crawler"))
+	assert.Equal(t, int32(3), fetcher.fetches.Load())
+}
+
+func TestSiteCrawler_Robots_FollowsRedirects(t *testing.T) {
+	handler := http.NewServeMux()
+	handler.HandleFunc("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/moved-robots.txt", http.StatusMovedPermanently)
+	})
+	handler.HandleFunc("/moved-robots.txt", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("User-agent: *\nDisallow: /private"))
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	baseUrl := mustParse(t, server.URL)
+	crawler, err := NewSiteCrawler(context.Background(), *baseUrl, &StdoutLogger{}, 1000, "Crawler", 1, nil, nil)
+	require.NoError(t, err)
+
+	assert.False(t, crawler.RobotsChecker.IsAllowed("/private", "Crawler"))
+	assert.True(t, crawler.RobotsChecker.IsAllowed("/public", "Crawler"))
+}
+
+func TestRobotsKey_IncludesDefaultPort(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, "https://example.com:443", robotsKey(mustParse(t, "https://example.com/page")))
+	assert.Equal(t, robotsKey(mustParse(t, "https://example.com/")), robotsKey(mustParse(t, "https://example.com:443/")))
+	assert.NotEqual(t, robotsKey(mustParse(t, "https://example.com/")), robotsKey(mustParse(t, "http://example.com/")))
+	assert.NotEqual(t, robotsKey(mustParse(t, "https://example.com/")), robotsKey(mustParse(t, "https://example.com:8443/")))
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"github.com/temoto/robotstxt"
+	"time"
 )
 
 // RobotsChecker is a struct that checks if a path is allowed by robots.txt rules
@@ -24,6 +25,30 @@ func (rc *RobotsChecker) IsAllowed(path, userAgent string) bool {
 	return rc.robotsData.TestAgent(path, userAgent)
 }
 
+// CrawlDelay returns the Crawl-delay requested for a specific user agent, or zero if none is set
+func (rc *RobotsChecker) CrawlDelay(userAgent string) time.Duration {
+	return rc.robotsData.FindGroup(userAgent).CrawlDelay
+}
+
+// Sitemaps returns the sitemap URLs listed in Sitemap: directives, in the order they appear
+func (rc *RobotsChecker) Sitemaps() []string {
+	if rc.robotsData == nil {
+		return nil
+	}
+	return rc.robotsData.Sitemaps
+}
+
+// NewRobotsCheckerFromStatus creates a RobotsChecker from a robots.txt response. A 2XX response is parsed as usual,
+// any other 4XX means there is no robots.txt so everything is allowed, and a 5XX means the site is unavailable so
+// everything is disallowed.
+func NewRobotsCheckerFromStatus(statusCode int, robotsTxt string) (*RobotsChecker, error) {
+	robots, err := robotstxt.FromStatusAndString(statusCode, robotsTxt)
+	if err != nil {
+		return nil, err
+	}
+	return &RobotsChecker{robotsData: robots}, nil
+}
+
 // NewRobotsChecker creates a new RobotsChecker instance and loads the robots.txt content
 func NewRobotsChecker(robotsTxt string) (*RobotsChecker, error) {
 	rc := &RobotsChecker{}
@@ -4,6 +4,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"testing"
+	"time"
 )
 
 func TestRobotsChecker_FallsBackToAllowOnBadString(t *testing.T) {
@@ -42,3 +43,42 @@ func TestNewRobotsChecker_LoadsRobots(t *testing.T) {
 	assert.True(t, rc.IsAllowed("/public/allowed", "TestBot"))
 	assert.False(t, rc.IsAllowed("/private/forbidden", "TestBot"))
 }
+
+func TestRobotsChecker_CrawlDelay(t *testing.T) {
+	t.Parallel()
+	rc, err := NewRobotsChecker("User-agent: *\nCrawl-delay: 2\n\nUser-agent: slowbot\nCrawl-delay: 0.5\nDisallow: /private")
+	require.NoError(t, err)
+	assert.Equal(t, 2*time.Second, rc.CrawlDelay("TestBot"))
+	assert.Equal(t, 500*time.Millisecond, rc.CrawlDelay("SlowBot"))
+
+	rc, err = NewRobotsChecker("")
+	require.NoError(t, err)
+	assert.Equal(t, time.Duration(0), rc.CrawlDelay("TestBot"))
+}
+
+func TestNewRobotsCheckerFromStatus(t *testing.T) {
+	t.Parallel()
+	rc, err := NewRobotsCheckerFromStatus(200, "User-agent: *\nDisallow: /private")
+	require.NoError(t, err)
+	assert.False(t, rc.IsAllowed("/private", "Test"))
+	assert.True(t, rc.IsAllowed("/public", "Test"))
+
+	rc, err = NewRobotsCheckerFromStatus(404, "")
+	require.NoError(t, err)
+	assert.True(t, rc.IsAllowed("/private", "Test"))
+
+	rc, err = NewRobotsCheckerFromStatus(503, "")
+	require.NoError(t, err)
+	assert.False(t, rc.IsAllowed("/public", "Test"))
+}
+
+func TestRobotsChecker_Sitemaps(t *testing.T) {
+	t.Parallel()
+	rc, err := NewRobotsChecker("User-agent: *\nDisallow: /private\n\nSitemap: https://example.com/sitemap_index.xml\nSitemap: https://cdn.example.com/sitemaps/news.xml\n")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"https://example.com/sitemap_index.xml", "https://cdn.example.com/sitemaps/news.xml"}, rc.Sitemaps())
+
+	rc, err = NewRobotsCheckerFromStatus(404, "")
+	require.NoError(t, err)
+	assert.Empty(t, rc.Sitemaps())
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// RobotsDirectives are the page-level indexing rules a page sets for crawlers, via <meta name="robots"> (or a
+// bot-specific meta name) and the X-Robots-Tag response header.
+type RobotsDirectives struct {
+	NoIndex  bool // The page asks not to be indexed
+	NoFollow bool // The page asks for none of its links to be followed
+}
+
+// Merge combines two sets of directives; the most restrictive wins.
+func (d RobotsDirectives) Merge(other RobotsDirectives) RobotsDirectives {
+	return RobotsDirectives{NoIndex: d.NoIndex || other.NoIndex, NoFollow: d.NoFollow || other.NoFollow}
+}
+
+// ParseRobotsDirectives parses a comma separated directive list such as "noindex, nofollow". Unknown directives are
+// ignored.
+func ParseRobotsDirectives(value string) RobotsDirectives {
+	var directives RobotsDirectives
+	for _, directive := range strings.Split(value, ",") {
+		switch strings.ToLower(strings.TrimSpace(directive)) {
+		case "noindex":
+			directives.NoIndex = true
+		case "nofollow":
+			directives.NoFollow = true
+		case "none":
+			directives.NoIndex = true
+			directives.NoFollow = true
+		}
+	}
+	return directives
+}
+
+// XRobotsTagDirectives returns the directives in a response's X-Robots-Tag headers that apply to userAgent. Each
+// header either applies to every crawler ("noindex") or is prefixed with the bot it is for ("googlebot: noindex").
+func XRobotsTagDirectives(header http.Header, userAgent string) RobotsDirectives {
+	var directives RobotsDirectives
+	for _, value := range header.Values("X-Robots-Tag") {
+		if bot, rules, ok := strings.Cut(value, ":"); ok && isBotName(bot) {
+			if !robotsNameMatches(bot, userAgent) {
+				continue
+			}
+			value = rules
+		}
+		directives = directives.Merge(ParseRobotsDirectives(value))
+	}
+	return directives
+}
+
+// RobotsDirectives returns the directives in the document's robots meta tags that apply to userAgent: the generic
+// <meta name="robots"> plus any meta tag named after our bot, e.g. <meta name="jakebot">.
+func (d *Document) RobotsDirectives(userAgent string) RobotsDirectives {
+	var directives RobotsDirectives
+	for _, meta := range d.MetaTags {
+		if meta.Name == "robots" || robotsNameMatches(meta.Name, userAgent) {
+			directives = directives.Merge(ParseRobotsDirectives(meta.Content))
+		}
+	}
+	return directives
+}
+
+// robotsNameMatches reports whether a bot name from a meta tag or X-Robots-Tag header refers to userAgent. Bot names
+// are product tokens such as "googlebot", so they match if the user agent contains them.
+func robotsNameMatches(name, userAgent string) bool {
+	name = strings.ToLower(strings.TrimSpace(name))
+	return name != "" && strings.Contains(strings.ToLower(userAgent), name)
+}
+
+// isBotName reports whether the text before a colon in an X-Robots-Tag value is a bot name, rather than part of a
+// directive that takes a value like "unavailable_after: 25 Jun 2010 15:00:00 PST".
+func isBotName(name string) bool {
+	name = strings.TrimSpace(name)
+	return name != "" && !strings.ContainsAny(name, " ,") && !strings.EqualFold(name, "unavailable_after")
+}
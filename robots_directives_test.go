@@ -0,0 +1,61 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+)
+
+func TestParseRobotsDirectives(t *testing.T) {
+	tests := map[string]RobotsDirectives{
+		"":                        {},
+		"index, follow":           {},
+		"noindex":                 {NoIndex: true},
+		"NOFOLLOW":                {NoFollow: true},
+		" noindex , nofollow ":    {NoIndex: true, NoFollow: true},
+		"none":                    {NoIndex: true, NoFollow: true},
+		"noarchive, max-snippet:": {},
+	}
+	for value, expected := range tests {
+		assert.Equal(t, expected, ParseRobotsDirectives(value), value)
+	}
+}
+
+func TestXRobotsTagDirectives(t *testing.T) {
+	userAgent := "Mozilla/5.0 (compatible; JakeBot/1.0)"
+	tests := []struct {
+		name     string
+		values   []string
+		expected RobotsDirectives
+	}{
+		{name: "no header", values: nil, expected: RobotsDirectives{}},
+		{name: "all bots", values: []string{"noindex, nofollow"}, expected: RobotsDirectives{NoIndex: true, NoFollow: true}},
+		{name: "our bot", values: []string{"jakebot: nofollow"}, expected: RobotsDirectives{NoFollow: true}},
+		{name: "another bot", values: []string{"googlebot: noindex"}, expected: RobotsDirectives{}},
+		{name: "several headers", values: []string{"googlebot: nofollow", "noindex"}, expected: RobotsDirectives{NoIndex: true}},
+		{name: "directive with a value", values: []string{"unavailable_after: 25 Jun 2010 15:00:00 PST"}, expected: RobotsDirectives{}},
+		{name: "directive list with a value", values: []string{"noindex, unavailable_after: 25 Jun 2010"}, expected: RobotsDirectives{NoIndex: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			for _, value := range tt.values {
+				header.Add("X-Robots-Tag", value)
+			}
+			assert.Equal(t, tt.expected, XRobotsTagDirectives(header, userAgent))
+		})
+	}
+}
+
+func TestDocument_RobotsDirectives(t *testing.T) {
+	doc, err := ParseDocument(`<head>
+		<meta name="description" content="noindex">
+		<meta name="Robots" content="noindex">
+		<meta name="googlebot" content="nofollow">
+	</head>`)
+	require.NoError(t, err)
+
+	assert.Equal(t, RobotsDirectives{NoIndex: true}, doc.RobotsDirectives("JakeBot/1.0"))
+	assert.Equal(t, RobotsDirectives{NoIndex: true, NoFollow: true}, doc.RobotsDirectives("Googlebot/2.1"))
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"golang.org/x/net/publicsuffix"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// ScopeMode says which hosts a crawl may follow links to.
+type ScopeMode int
+
+const (
+	ScopeExactHost         ScopeMode = iota // Only the seed's host (and port)
+	ScopeSubdomains                         // The seed's host and any subdomain of it
+	ScopeRegistrableDomain                  // Any host under the seed's registrable domain (eTLD+1), e.g. *.bbc.co.uk
+	ScopeHostList                           // The seed's host plus the hosts listed in Scope.Hosts
+)
+
+// Scope decides which URLs are part of a crawl. The zero value keeps the crawl to the seed's exact host, with http and
+// https treated the same.
+type Scope struct {
+	Mode  ScopeMode
+	Hosts []string // Extra hosts for ScopeHostList. Entries with a port only match that port
+	// PathPrefix, if set, restricts the crawl to URLs whose path starts with it, e.g. "/docs/"
+	PathPrefix string
+	// StrictScheme only allows URLs with the same scheme as the seed, so an https crawl won't follow http links
+	StrictScheme bool
+	// WWWEquivalent treats www.example.com and example.com as the same host
+	WWWEquivalent bool
+}
+
+// Contains reports whether u is in scope for a crawl seeded from seed. Both URLs should already be canonicalised.
+func (s Scope) Contains(seed, u *url.URL) bool {
+	if s.StrictScheme && u.Scheme != seed.Scheme {
+		return false
+	}
+	if !strings.HasPrefix(u.Path, s.PathPrefix) {
+		return false
+	}
+	return s.containsHost(seed, u)
+}
+
+// containsHost applies the scope mode to the URL's host.
+func (s Scope) containsHost(seed, u *url.URL) bool {
+	seedHost, host := s.host(seed.Host), s.host(u.Host)
+	if host == seedHost {
+		return true
+	}
+	seedName, name := s.host(seed.Hostname()), s.host(u.Hostname())
+	switch s.Mode {
+	case ScopeSubdomains:
+		return strings.HasSuffix(name, "."+seedName)
+	case ScopeRegistrableDomain:
+		if net.ParseIP(name) != nil {
+			return false
+		}
+		seedDomain, err := publicsuffix.EffectiveTLDPlusOne(seedName)
+		if err != nil {
+			return false
+		}
+		return name == seedDomain || strings.HasSuffix(name, "."+seedDomain)
+	case ScopeHostList:
+		for _, listed := range s.Hosts {
+			listed = s.host(strings.ToLower(listed))
+			if listed == host || listed == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// host strips a leading "www." when www and non-www hosts are equivalent.
+func (s Scope) host(host string) string {
+	if s.WWWEquivalent {
+		return strings.TrimPrefix(host, "www.")
+	}
+	return host
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestScope_Contains(t *testing.T) {
+	tests := []struct {
+		name     string
+		scope    Scope
+		seed     string
+		url      string
+		expected bool
+	}{
+		{name: "exact host", scope: Scope{}, seed: "https://bbc.co.uk/", url: "https://bbc.co.uk/news", expected: true},
+		{name: "exact host ignores scheme", scope: Scope{}, seed: "https://bbc.co.uk/", url: "http://bbc.co.uk/news", expected: true},
+		{name: "exact host rejects www", scope: Scope{}, seed: "https://bbc.co.uk/", url: "https://www.bbc.co.uk/", expected: false},
+		{name: "exact host rejects other port", scope: Scope{}, seed: "https://bbc.co.uk/", url: "https://bbc.co.uk:8443/", expected: false},
+		{name: "www equivalent", scope: Scope{WWWEquivalent: true}, seed: "https://bbc.co.uk/", url: "https://www.bbc.co.uk/", expected: true},
+		{name: "www equivalent from www seed", scope: Scope{WWWEquivalent: true}, seed: "https://www.bbc.co.uk/", url: "https://bbc.co.uk/", expected: true},
+		{name: "strict scheme", scope: Scope{StrictScheme: true}, seed: "https://bbc.co.uk/", url: "http://bbc.co.uk/", expected: false},
+		{name: "subdomain", scope: Scope{Mode: ScopeSubdomains}, seed: "https://bbc.co.uk/", url: "https://news.bbc.co.uk/", expected: true},
+		{name: "nested subdomain", scope: Scope{Mode: ScopeSubdomains}, seed: "https://bbc.co.uk/", url: "https://a.b.bbc.co.uk/", expected: true},
+		{name: "subdomain isn't a suffix match", scope: Scope{Mode: ScopeSubdomains}, seed: "https://bbc.co.uk/", url: "https://notbbc.co.uk/", expected: false},
+		{name: "parent isn't a subdomain", scope: Scope{Mode: ScopeSubdomains}, seed: "https://www.bbc.co.uk/", url: "https://bbc.co.uk/", expected: false},
+		{name: "registrable domain", scope: Scope{Mode: ScopeRegistrableDomain}, seed: "https://www.bbc.co.uk/", url: "https://news.bbc.co.uk/", expected: true},
+		{name: "registrable domain apex", scope: Scope{Mode: ScopeRegistrableDomain}, seed: "https://www.bbc.co.uk/", url: "https://bbc.co.uk/", expected: true},
+		{name: "registrable domain respects public suffix", scope: Scope{Mode: ScopeRegistrableDomain}, seed: "https://www.bbc.co.uk/", url: "https://itv.co.uk/", expected: false},
+		{name: "registrable domain ip", scope: Scope{Mode: ScopeRegistrableDomain}, seed: "http://127.0.0.1/", url: "http://127.0.0.2/", expected: false},
+		{name: "host list", scope: Scope{Mode: ScopeHostList, Hosts: []string{"cdn.example.net", "Docs.Example.org"}}, seed: "https://example.com/", url: "https://docs.example.org/", expected: true},
+		{name: "host list includes seed", scope: Scope{Mode: ScopeHostList, Hosts: []string{"cdn.example.net"}}, seed: "https://example.com/", url: "https://example.com/a", expected: true},
+		{name: "host list with port", scope: Scope{Mode: ScopeHostList, Hosts: []string{"example.net:8080"}}, seed: "https://example.com/", url: "https://example.net/", expected: false},
+		{name: "host list rejects others", scope: Scope{Mode: ScopeHostList, Hosts: []string{"cdn.example.net"}}, seed: "https://example.com/", url: "https://example.org/", expected: false},
+		{name: "path prefix", scope: Scope{PathPrefix: "/docs/"}, seed: "https://example.com/docs/", url: "https://example.com/docs/intro", expected: true},
+		{name: "path prefix rejects", scope: Scope{PathPrefix: "/docs/"}, seed: "https://example.com/docs/", url: "https://example.com/blog/", expected: false},
+		{name: "path prefix with subdomains", scope: Scope{Mode: ScopeSubdomains, PathPrefix: "/docs/"}, seed: "https://example.com/docs/", url: "https://api.example.com/docs/v1", expected: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.scope.Contains(mustParse(t, tt.seed), mustParse(t, tt.url)))
+		})
+	}
+}
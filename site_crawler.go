@@ -2,31 +2,81 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"github.com/samber/lo"
+	"io"
+	"net/http"
 	"net/url"
+	"strings"
 	"sync"
 	"time"
 )
 
 type SiteCrawler struct {
-	RobotsChecker       *RobotsChecker
-	BaseURL             url.URL
+	RobotsChecker       *RobotsChecker // The robots.txt checker for BaseURL's host, as fetched when the crawler was created
+	BaseURL             url.URL        // The first seed
+	Seeds               []url.URL      // Every seed the crawl starts from, possibly on different hosts
 	TimeoutMilliseconds time.Duration
 	Logger              Logger
-	CrawlQueue          chan func()
+	Frontier            Frontier
 	crawlWg             *sync.WaitGroup
+	workersWg           sync.WaitGroup
+	stopWorkers         chan struct{}
 	PostProcessQueue    chan func()
 	postProcessWg       *sync.WaitGroup
 	UserAgent           string
 	WorkerPoolSize      int
-	crawledPages        sync.Map
-	postProcessors      []PostProcessor
+	Fetcher             Fetcher
+	RetryPolicy         RetryPolicy
+	Throttle            *Throttle
+	RateLimiter         *HostRateLimiter
+	Limits              CrawlLimits
+	Stats               *CrawlStats
+	budget              *crawlBudget
+	CheckpointPath      string
+	CheckpointInterval  time.Duration
+	ValidatorStore      ValidatorStore
+	Recrawl             bool
+	RecordAssets        bool
+	LinkPolicy          LinkPolicy
+	Canonicalizer       *Canonicalizer
+	Filter              *URLFilter
+	Scope               Scope
+	RobotsTTL           time.Duration // How long each host's robots.txt is cached before it is fetched again
+	RobotsErrorTTL      time.Duration // How long a host is disallowed after its robots.txt fails to load with a 5XX or network error
+	SitemapLimits       SitemapLimits
+	ExtraSitemapURLs    []string // Absolute sitemap URLs to read as well as those found for the seeds
+	// RecordSitemapExtensions keeps sitemap entries' image, video, news and hreflang extensions on the way to
+	// post-processors. They are dropped by default, as they travel through the frontier with every URL.
+	RecordSitemapExtensions bool
+	// DiscoverFeeds reads RSS and Atom feeds, from FeedPaths on each seed's site and from pages'
+	// <link rel="alternate"> feed links, and crawls their items
+	DiscoverFeeds bool
+	FeedPaths     []string
+	// RespectRobotsDirectives stops the crawler following links from nofollow pages (by meta robots or X-Robots-Tag)
+	// and links marked rel=nofollow.
+	RespectRobotsDirectives bool
+	robots                  sync.Map
+	processedPages          sync.Map
+	pauseMu                 sync.Mutex
+	paused                  chan struct{}
+	crawledPages            sync.Map
+	canonicalAliases        sync.Map
+	processedCanonicals     sync.Map
+	sitemapMu               sync.Mutex
+	sitemapReports          []SitemapReport
+	postProcessors          []PostProcessor
 }
 
 // Crawl starts the crawling process for the site.
 func (sc *SiteCrawler) Crawl(ctx context.Context) error {
-	sc.Logger.Debug("Starting site crawler for %s", sc.BaseURL.String())
+	sc.Logger.Debug("Starting site crawler for %s", seedList(sc.Seeds))
 
+	if frontier, ok := sc.Frontier.(DroppingFrontier); ok {
+		frontier.OnDrop(sc.releaseDropped)
+	}
+	sc.stopWorkers = make(chan struct{})
 	sc.startCrawlWorkers(ctx)
 	sc.startPostProcessingWorkers(ctx)
 
@@ -35,10 +85,47 @@ func (sc *SiteCrawler) Crawl(ctx context.Context) error {
 		return err
 	}
 
-	sc.AddURLToCrawlQueue(ctx, &sc.BaseURL)
+	if sc.DiscoverFeeds {
+		sc.CrawlFromFeeds(ctx)
+	}
+
+	for _, seed := range sc.Seeds {
+		sc.AddURLToCrawlQueue(ctx, FrontierItem{URL: seed.String(), Source: SourceSeed})
+	}
+
+	crawlDone := make(chan struct{})
+	go func() {
+		sc.crawlWg.Wait()
+		close(crawlDone)
+	}()
+	stopCheckpointing := make(chan struct{})
+	defer close(stopCheckpointing)
+	sc.startCheckpointing(stopCheckpointing)
+
+	select {
+	case <-crawlDone:
+		sc.saveValidators()
+		sc.writeFinalCheckpoint()
+		if err := sc.Frontier.Close(); err != nil {
+			sc.Logger.Warn("Failed to close crawl frontier: %v", err)
+		}
+		sc.stopCrawlWorkers()
+	case <-ctx.Done():
+		sc.Logger.Warn("Crawl cancelled with %d URLs left in the frontier: %v", sc.Frontier.Len(), ctx.Err())
+		sc.saveValidators()
+		sc.writeFinalCheckpoint()
+		if err := sc.Frontier.Close(); err != nil {
+			sc.Logger.Warn("Failed to close crawl frontier: %v", err)
+		}
+		// Nothing will pop what's left in the frontier now, so release it from the wait group and let in-flight
+		// pages (which bail out on the cancelled context) finish.
+		sc.crawlWg.Add(-sc.Frontier.Len())
+		<-crawlDone
+		sc.stopCrawlWorkers()
+		close(sc.PostProcessQueue)
+		return ctx.Err()
+	}
 
-	sc.crawlWg.Wait()
-	close(sc.CrawlQueue)
 	sc.Logger.Debug("Crawl complete, waiting for post-processing tasks to finish")
 	close(sc.PostProcessQueue)
 	sc.postProcessWg.Wait()
@@ -47,49 +134,226 @@ func (sc *SiteCrawler) Crawl(ctx context.Context) error {
 	return nil
 }
 
-// CrawlPage fetches a page, extracts links, and adds them to the crawl queue.
+// CrawlPage fetches a page, extracts links, and adds them to the crawl queue one level deeper than the page.
 // It also adds the page to the post-processing queue.
-func (sc *SiteCrawler) CrawlPage(ctx context.Context, pageURL *url.URL) {
+func (sc *SiteCrawler) CrawlPage(ctx context.Context, item FrontierItem) {
 	select {
 	case <-ctx.Done():
-		sc.Logger.Warn("Crawl aborted for %s: %v", pageURL.String(), ctx.Err())
+		sc.Logger.Warn("Crawl aborted for %s: %v", item.URL, ctx.Err())
 		return
 	default:
 	}
 
+	pageURL, err := url.Parse(item.URL)
+	if err != nil {
+		sc.Logger.Warn("Skipping unparseable URL %s: %v", item.URL, err)
+		return
+	}
+	stats := sc.Stats.ForHost(pageURL.Host)
+	// The budget is claimed here rather than when the URL is discovered, so the frontier's priority order decides
+	// which pages fit
+	if reason, ok := sc.budget.reserve(sc.Limits, pageURL.Path, sc.Stats.BytesDownloaded()); !ok {
+		sc.Logger.Debug("Crawl limit %s reached, skipping: %s", reason, item.URL)
+		stats.RecordSkip(reason)
+		return
+	}
+
 	sc.Logger.Debug("Crawling page: %s", pageURL.String())
-	timeoutCtx, cancel := context.WithTimeout(ctx, sc.TimeoutMilliseconds*time.Millisecond)
-	defer cancel()
-	page, err := FetchPage(timeoutCtx, pageURL)
+	previous, seen := sc.storedValidators(item.URL)
+	var conditional Validators
+	if sc.Recrawl {
+		conditional = previous
+	}
+	page, err := sc.fetch(ctx, pageURL, conditional)
 	if err != nil {
 		sc.Logger.Warn("Failed to fetch page %s: %v", pageURL.String(), err)
+		sc.budget.release(sc.Limits, pageURL.Path)
 		return
 	}
-	sc.Logger.Debug("Page fetched successfully: %s", pageURL.String())
-	links, err := ExtractLinks(page)
-	if err != nil {
-		sc.Logger.Error("Failed to extract links from page %s: %v", pageURL.String(), err)
+	stats.RecordCrawled()
+	sc.Logger.Debug("Page fetched successfully: %s (status %d, %d bytes, %s, %d attempts)", pageURL.String(), page.StatusCode, page.ContentLength, page.Duration, page.Attempts)
+
+	var follow, feeds []string
+	var links, assets []Link
+	var canonical string
+	change := PageNew
+	directives := XRobotsTagDirectives(page.Header, sc.UserAgent)
+	if page.StatusCode == http.StatusNotModified && seen {
+		// There's no body to extract links from, follow the ones found last time instead
+		follow = previous.Links
+		canonical = previous.Canonical
+		change = PageUnchanged
+		previous.FetchedAt = time.Now()
+		sc.ValidatorStore.Put(item.URL, previous)
+	} else {
+		doc, err := ParseDocument(page.Body)
+		if err != nil {
+			sc.Logger.Error("Failed to extract links from page %s: %v", pageURL.String(), err)
+			return
+		}
+		directives = directives.Merge(doc.RobotsDirectives(sc.UserAgent))
+		base := documentBase(pageURL, page, doc)
+		links, assets = sc.resolveLinks(pageURL, base, doc)
+		canonical = sc.resolveCanonical(pageURL, base, doc)
+		follow, feeds = sc.linksToFollow(pageURL, links, directives)
+		if sc.ValidatorStore != nil {
+			validators := ValidatorsFromResult(page, follow)
+			validators.Canonical = canonical
+			if seen {
+				change = PageChanged
+				if validators.ContentHash == previous.ContentHash {
+					change = PageUnchanged
+				}
+			}
+			sc.ValidatorStore.Put(item.URL, validators)
+		}
+	}
+	for _, link := range follow {
+		sc.AddURLToCrawlQueue(ctx, FrontierItem{URL: link, Source: SourceLink, Depth: item.Depth + 1})
+	}
+	for _, feed := range feeds {
+		sc.AddURLToCrawlQueue(ctx, FrontierItem{URL: feed, Source: SourceLink, Depth: item.Depth + 1, Feed: true})
+	}
+	if !sc.claimCanonical(item.URL, canonical) {
+		sc.Logger.Debug("Page %s is a duplicate of already processed canonical %s, skipping post-processing", item.URL, canonical)
+		stats.RecordSkip(SkipCanonical)
 		return
 	}
+	sc.AddURLToPostProcessQueue(ctx, &CrawledPage{
+		URL:       pageURL,
+		Result:    page,
+		Change:    change,
+		Canonical: canonical,
+		Links:     links,
+		Assets:    assets,
+		NoIndex:   directives.NoIndex,
+		Robots:    directives,
+		Sitemap:   item.Sitemap,
+		Source:    item.Source,
+	})
+}
+
+// linksToFollow returns the URLs of the page links that should be followed, recording a skip for the rest. Links are
+// dropped if RespectRobotsDirectives is set and the page or link is nofollow, or if the LinkPolicy rejects them. If
+// DiscoverFeeds is set, links to feeds are returned separately, to be queued as feeds rather than crawled as pages.
+func (sc *SiteCrawler) linksToFollow(pageURL *url.URL, links []Link, directives RobotsDirectives) ([]string, []string) {
+	follow := make([]string, 0, len(links))
+	var feeds []string
 	for _, link := range links {
-		parsedLink, err := ResolveAndCleanURL(&sc.BaseURL, link)
+		if sc.RespectRobotsDirectives && (directives.NoFollow || link.HasRel("nofollow")) {
+			sc.Logger.Debug("Not following nofollow link %s on page %s", link.URL, pageURL.String())
+			sc.linkStats(link).RecordSkip(SkipNoFollow)
+			continue
+		}
+		if sc.LinkPolicy != nil && !sc.LinkPolicy(pageURL, link) {
+			sc.Logger.Debug("Link policy rejected %s on page %s", link.URL, pageURL.String())
+			sc.linkStats(link).RecordSkip(SkipLinkPolicy)
+			continue
+		}
+		if sc.DiscoverFeeds && link.IsFeed() {
+			feeds = append(feeds, link.URL)
+			continue
+		}
+		follow = append(follow, link.URL)
+	}
+	return follow, feeds
+}
+
+// linkStats returns the statistics for the host a resolved link points to.
+func (sc *SiteCrawler) linkStats(link Link) *CrawlStats {
+	parsed, err := url.Parse(link.URL)
+	if err != nil {
+		return sc.Stats
+	}
+	return sc.Stats.ForHost(parsed.Host)
+}
+
+// documentBase returns the URL a page's relative links resolve against: the URL it was served from, after redirects,
+// overridden by its <base href>.
+func documentBase(pageURL *url.URL, page *FetchResult, doc *Document) *url.URL {
+	servedFrom := pageURL
+	if page.FinalURL != nil {
+		servedFrom = page.FinalURL
+	}
+	return doc.ResolveBase(servedFrom)
+}
+
+// resolveLinks resolves a page's links to absolute URLs against the document's base, dropping any that are invalid.
+// It returns the page links and, if RecordAssets is set, the asset links.
+func (sc *SiteCrawler) resolveLinks(pageURL *url.URL, base *url.URL, doc *Document) ([]Link, []Link) {
+	var pages, assets []Link
+	for _, link := range doc.Links {
+		if !link.Kind.IsPage() && !sc.RecordAssets {
+			continue
+		}
+		parsedLink, err := ResolveAndCleanURL(base, link.URL)
 		if err != nil {
-			sc.Logger.Warn("Skipping invalid link %s on page %s: %v", link, pageURL.String(), err)
+			sc.Logger.Warn("Skipping invalid %s link %s on page %s: %v", link.Kind, link.URL, pageURL.String(), err)
 			continue
 		}
-		sc.AddURLToCrawlQueue(ctx, parsedLink)
+		link.URL = parsedLink.String()
+		if link.Kind.IsPage() {
+			pages = append(pages, link)
+		} else {
+			assets = append(assets, link)
+		}
+	}
+	return pages, assets
+}
+
+// storedValidators returns the validators recorded for a URL by a previous crawl, if there is a ValidatorStore.
+func (sc *SiteCrawler) storedValidators(pageURL string) (Validators, bool) {
+	if sc.ValidatorStore == nil {
+		return Validators{}, false
 	}
-	sc.AddURLToPostProcessQueue(ctx, pageURL, page)
+	return sc.ValidatorStore.Get(pageURL)
 }
 
-// AddURLToCrawlQueue adds a URL to the crawl queue if it is allowed by robots.txt and matches the base URL host.
-func (sc *SiteCrawler) AddURLToCrawlQueue(ctx context.Context, url *url.URL) {
-	if !sc.RobotsChecker.IsAllowed(url.String(), sc.UserAgent) {
+// saveValidators persists the ValidatorStore, if there is one.
+func (sc *SiteCrawler) saveValidators() {
+	if sc.ValidatorStore == nil {
+		return
+	}
+	if err := sc.ValidatorStore.Save(); err != nil {
+		sc.Logger.Error("Failed to save page validators: %v", err)
+	}
+}
+
+// AddURLToCrawlQueue adds a URL to the crawl queue if it passes the Filter, is allowed by its host's robots.txt, is
+// within the Scope of one of the seeds and within the max depth. The URL is canonicalised first, and its canonical
+// form is what is deduplicated and enqueued. Page budgets are only claimed when the URL is crawled. The reason for
+// skipping a URL is recorded in the host's Stats.
+func (sc *SiteCrawler) AddURLToCrawlQueue(ctx context.Context, item FrontierItem) {
+	parsed, err := url.Parse(item.URL)
+	if err != nil {
+		sc.Logger.Warn("Skipping unparseable URL %s: %v", item.URL, err)
+		return
+	}
+	url, err := sc.Canonicalizer.Canonicalize(parsed)
+	if err != nil {
+		sc.Logger.Warn("Skipping URL %s that can't be canonicalised: %v", item.URL, err)
+		return
+	}
+	stats := sc.Stats.ForHost(url.Host)
+	if allowed, rule := sc.Filter.Allowed(url); !allowed {
+		sc.Logger.Debug("URL rejected by filter rule %s: %s", rule, url.String())
+		stats.RecordSkip(SkipFiltered)
+		return
+	}
+	if !sc.inScope(url) {
+		sc.Logger.Warn("URL is outside the crawl scope of %s, skipping: %s", seedList(sc.Seeds), url.String())
+		stats.RecordSkip(SkipOutOfScope)
+		return
+	}
+	if !sc.robotsFor(ctx, url).IsAllowed(url.RequestURI(), sc.UserAgent) {
 		sc.Logger.Warn("URL not allowed by robots.txt: %s", url.String())
+		stats.RecordSkip(SkipRobots)
 		return
 	}
-	if url.Host != sc.BaseURL.Host {
-		sc.Logger.Warn("URL host %s does not match base URL host %s, skipping: %s", url.Host, sc.BaseURL.Host, url.String())
+	if sc.Limits.exceedsDepth(item.Depth) {
+		// Checked before deduplication so the URL can still be crawled if it is found again closer to a seed
+		sc.Logger.Debug("URL exceeds max depth %d, skipping: %s", sc.Limits.MaxDepth, url.String())
+		stats.RecordSkip(SkipMaxDepth)
 		return
 	}
 	_, loaded := sc.crawledPages.LoadOrStore(url.String(), struct{}{})
@@ -98,76 +362,281 @@ func (sc *SiteCrawler) AddURLToCrawlQueue(ctx context.Context, url *url.URL) {
 		return
 	}
 	sc.Logger.Debug("Adding URL to crawl queue: %s", url.String())
+	stats.RecordEnqueued()
 	sc.crawlWg.Add(1)
-	sc.CrawlQueue <- func() {
-		defer sc.crawlWg.Done()
-		sc.CrawlPage(ctx, url)
+	item.URL = url.String()
+	if err := sc.Frontier.Push(item); err != nil {
+		sc.crawlWg.Done()
+		sc.Logger.Error("Failed to add URL %s to the crawl frontier: %v", url.String(), err)
+	}
+}
+
+// inScope reports whether a canonical URL is within the Scope of any of the seeds.
+func (sc *SiteCrawler) inScope(u *url.URL) bool {
+	for i := range sc.Seeds {
+		if sc.Scope.Contains(sc.canonicalSeed(i), u) {
+			return true
+		}
+	}
+	return false
+}
+
+// canonicalSeed returns a seed in the same canonical form as the URLs compared against it.
+func (sc *SiteCrawler) canonicalSeed(i int) *url.URL {
+	seed, err := sc.Canonicalizer.Canonicalize(&sc.Seeds[i])
+	if err != nil {
+		return &sc.Seeds[i]
 	}
+	return seed
+}
+
+// seedList formats seeds for logging.
+func seedList(seeds []url.URL) string {
+	return strings.Join(lo.Map(seeds, func(seed url.URL, _ int) string { return seed.String() }), ", ")
 }
 
-// AddURLToPostProcessQueue adds a URL to the post-processing queue for further processing.
-func (sc *SiteCrawler) AddURLToPostProcessQueue(ctx context.Context, pageURL *url.URL, pageContent string) {
+// AddURLToPostProcessQueue adds a page to the post-processing queue for further processing.
+func (sc *SiteCrawler) AddURLToPostProcessQueue(ctx context.Context, page *CrawledPage) {
 	for _, processor := range sc.postProcessors {
 		sc.postProcessWg.Add(1)
-		sc.PostProcessQueue <- func() {
-			sc.Logger.Debug("Processing page: %s", pageURL)
+		task := func() {
+			sc.Logger.Debug("Processing page: %s", page.URL)
 			defer sc.postProcessWg.Done()
-			if err := processor.Process(ctx, pageURL, pageContent); err != nil {
-				sc.Logger.Error("Failed to process page %s: %v", pageURL, err)
+			if err := processor.Process(ctx, page); err != nil {
+				sc.Logger.Error("Failed to process page %s: %v", page.URL, err)
 			}
 		}
+		select {
+		case sc.PostProcessQueue <- task:
+		case <-ctx.Done():
+			sc.postProcessWg.Done()
+			sc.Logger.Warn("Post-processing aborted for %s: %v", page.URL, ctx.Err())
+			return
+		}
 	}
 }
 
-// CrawlFromSiteMap fetches the sitemap, extracts URLs, and adds them to the crawl queue.
-func (sc *SiteCrawler) CrawlFromSiteMap(ctx context.Context) error {
-	siteMapUrl, err := sc.BaseURL.Parse("/sitemap.xml")
+// fetch fetches a page through the crawler's Fetcher, applying the per-attempt timeout and retrying transient
+// failures according to the RetryPolicy. If validators are given and the Fetcher is a ConditionalFetcher the page is
+// fetched conditionally.
+func (sc *SiteCrawler) fetch(ctx context.Context, pageURL *url.URL, validators Validators) (*FetchResult, error) {
+	result, err := sc.withRetries(ctx, pageURL, func() (*FetchResult, error) {
+		return sc.fetchOnce(ctx, pageURL, validators)
+	})
 	if err != nil {
-		sc.Logger.Error("Failed to parse sitemap URL: %v", err)
-		return err
+		return nil, err
 	}
-	siteMap, err := FetchPage(ctx, siteMapUrl)
+	sc.Stats.ForHost(pageURL.Host).RecordBytes(result.ContentLength)
+	return result, nil
+}
+
+// fetchStream fetches a page like fetch, but returns its body unread if the Fetcher is a StreamingFetcher. The
+// caller must close the body, which holds on to the host's throttle slot until it is closed. The page timeout only
+// applies until the response headers arrive; the whole download, body included, is bounded by bodyTimeout instead,
+// with zero meaning no limit. Other Fetchers' bodies are read in full and handed back as a reader.
+func (sc *SiteCrawler) fetchStream(ctx context.Context, pageURL *url.URL, bodyTimeout time.Duration) (*FetchResult, io.ReadCloser, error) {
+	streamer, ok := sc.Fetcher.(StreamingFetcher)
+	if !ok {
+		result, err := sc.fetch(ctx, pageURL, Validators{})
+		if err != nil {
+			return nil, nil, err
+		}
+		return result, io.NopCloser(strings.NewReader(result.Body)), nil
+	}
+	var body io.ReadCloser
+	result, err := sc.withRetries(ctx, pageURL, func() (*FetchResult, error) {
+		var result *FetchResult
+		var err error
+		result, body, err = sc.streamOnce(ctx, pageURL, streamer, bodyTimeout)
+		return result, err
+	})
 	if err != nil {
-		sc.Logger.Warn("Failed to fetch sitemap: %v", err)
-		return nil
+		return nil, nil, err
+	}
+	return result, body, nil
+}
+
+// withRetries makes fetch attempts until one succeeds, retrying transient failures according to the RetryPolicy and
+// pausing hosts that tell us to slow down.
+func (sc *SiteCrawler) withRetries(ctx context.Context, pageURL *url.URL, attempt func() (*FetchResult, error)) (*FetchResult, error) {
+	maxAttempts := max(sc.RetryPolicy.MaxAttempts, 1)
+	for attempts := 1; ; attempts++ {
+		result, err := attempt()
+		if err == nil {
+			result.Attempts = attempts
+			return result, nil
+		}
+		delay := sc.RetryPolicy.Backoff(attempts)
+		if retryAfter, ok := retryAfterFromError(err); ok {
+			// Capped like the host's pause, so a huge Retry-After can't hold a worker for hours
+			delay = sc.Throttle.capPause(max(delay, retryAfter))
+		}
+		if isThrottlingError(err) {
+			sc.Throttle.Throttled(pageURL.Host, delay)
+			sc.Logger.Warn("Host %s is throttling us, pausing for %s and lowering concurrency to %d", pageURL.Host, delay, sc.Throttle.Concurrency(pageURL.Host))
+		}
+		if ctx.Err() != nil || !sc.RetryPolicy.IsRetryable(err) {
+			return nil, err
+		}
+		if attempts >= maxAttempts {
+			sc.Logger.Warn("Giving up on %s after %d attempts: %v", pageURL.String(), attempts, err)
+			return nil, err
+		}
+		sc.Logger.Warn("Attempt %d/%d for %s failed: %v, retrying in %s", attempts, maxAttempts, pageURL.String(), err, delay)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// fetchOnce makes a single fetch attempt, holding one of the host's throttle slots for its duration and waiting for
+// the host's rate limiter.
+func (sc *SiteCrawler) fetchOnce(ctx context.Context, pageURL *url.URL, validators Validators) (*FetchResult, error) {
+	if err := sc.Throttle.Acquire(ctx, pageURL.Host); err != nil {
+		return nil, err
+	}
+	defer sc.Throttle.Release(pageURL.Host)
+	if err := sc.RateLimiter.Wait(ctx, pageURL.Host); err != nil {
+		return nil, err
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, sc.TimeoutMilliseconds*time.Millisecond)
+	defer cancel()
+	var result *FetchResult
+	var err error
+	if conditionalFetcher, ok := sc.Fetcher.(ConditionalFetcher); ok && validators.conditional() {
+		result, err = conditionalFetcher.FetchPageConditional(timeoutCtx, pageURL, validators)
+	} else {
+		result, err = sc.Fetcher.FetchPage(timeoutCtx, pageURL)
+	}
+	if err == nil {
+		sc.Throttle.Succeeded(pageURL.Host)
+	}
+	return result, err
+}
+
+// streamOnce makes a single streaming fetch attempt like fetchOnce. On success the host's throttle slot and the
+// bodyTimeout are only released when the returned body is closed.
+func (sc *SiteCrawler) streamOnce(ctx context.Context, pageURL *url.URL, streamer StreamingFetcher, bodyTimeout time.Duration) (*FetchResult, io.ReadCloser, error) {
+	if err := sc.Throttle.Acquire(ctx, pageURL.Host); err != nil {
+		return nil, nil, err
+	}
+	if err := sc.RateLimiter.Wait(ctx, pageURL.Host); err != nil {
+		sc.Throttle.Release(pageURL.Host)
+		return nil, nil, err
+	}
+
+	var streamCtx context.Context
+	var cancel context.CancelFunc
+	if bodyTimeout > 0 {
+		streamCtx, cancel = context.WithTimeout(ctx, bodyTimeout)
+	} else {
+		streamCtx, cancel = context.WithCancel(ctx)
+	}
+	// A deadline can't be lifted once the headers are in, so the page timeout cancels the request from a timer instead
+	headerTimeout := time.AfterFunc(sc.TimeoutMilliseconds*time.Millisecond, cancel)
+	result, body, err := streamer.FetchStream(streamCtx, pageURL)
+	if !headerTimeout.Stop() {
+		if err == nil {
+			body.Close()
+		}
+		// Reported as a deadline rather than a cancellation so that it is retried like any other timeout
+		err = fmt.Errorf("waiting for the response headers of %s: %w", pageURL.String(), context.DeadlineExceeded)
 	}
-	siteMapUrls, err := ParseSitemapForUrls(siteMap)
 	if err != nil {
-		sc.Logger.Error("Failed to parse sitemap for URLs: %v", err)
+		cancel()
+		sc.Throttle.Release(pageURL.Host)
+		return nil, nil, err
+	}
+	sc.Throttle.Succeeded(pageURL.Host)
+	return result, &streamedBody{ReadCloser: body, release: func(read int64) {
+		cancel()
+		sc.Throttle.Release(pageURL.Host)
+		sc.Stats.ForHost(pageURL.Host).RecordBytes(read)
+	}}, nil
+}
+
+// streamedBody is a response body being streamed to the crawler. It counts the bytes read from it, and closing it
+// releases what the fetch was holding on to.
+type streamedBody struct {
+	io.ReadCloser
+	read    int64
+	release func(read int64)
+	closed  bool
+}
+
+func (b *streamedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	return n, err
+}
+
+func (b *streamedBody) Close() error {
+	if b.closed {
 		return nil
 	}
-	lo.ForEach(siteMapUrls, func(raw string, _ int) {
-		parsed, err := ResolveAndCleanURL(&sc.BaseURL, raw)
-		if err != nil {
-			sc.Logger.Warn("Skipping invalid URL in sitemap: %s", raw)
-			return
-		}
-		fullURL := sc.BaseURL.ResolveReference(parsed)
-		sc.AddURLToCrawlQueue(ctx, fullURL)
-	})
-	return nil
+	b.closed = true
+	err := b.ReadCloser.Close()
+	b.release(b.read)
+	return err
 }
 
-// startCrawlWorkers starts a pool of workers that will process tasks from the crawl queue.
+// startCrawlWorkers starts a pool of workers that will crawl URLs popped from the frontier.
 func (sc *SiteCrawler) startCrawlWorkers(ctx context.Context) {
 	for i := 0; i < sc.WorkerPoolSize; i++ {
+		sc.workersWg.Add(1)
 		go func() {
+			defer sc.workersWg.Done()
 			for {
-				select {
-				case <-ctx.Done():
-					sc.Logger.Debug("Crawl context cancelled")
+				if !sc.waitWhilePaused(ctx) {
+					sc.Logger.Debug("Crawl worker stopping while paused")
 					return
-				case task, ok := <-sc.CrawlQueue:
-					if !ok {
-						return
-					}
-					task()
 				}
+				item, ok := sc.Frontier.Pop(ctx)
+				if !ok {
+					sc.Logger.Debug("Crawl worker stopping")
+					return
+				}
+				if item.Feed {
+					sc.CrawlFeed(ctx, item)
+				} else {
+					sc.CrawlPage(ctx, item)
+				}
+				if ctx.Err() == nil {
+					// Pages interrupted by cancellation stay in flight, so they are checkpointed as pending
+					sc.processedPages.Store(item.URL, struct{}{})
+					sc.Frontier.Done(item)
+				}
+				sc.crawlWg.Done()
 			}
 		}()
 	}
 }
 
+// releaseDropped stops waiting for URLs the frontier lost, so the crawl can still finish.
+func (sc *SiteCrawler) releaseDropped(dropped int, err error) {
+	sc.Logger.Error("Crawl frontier lost %d URLs: %v", dropped, err)
+	sc.crawlWg.Add(-dropped)
+}
+
+// stopCrawlWorkers waits for the crawl workers to exit once the crawl is over, releasing any that are paused.
+func (sc *SiteCrawler) stopCrawlWorkers() {
+	close(sc.stopWorkers)
+	sc.workersWg.Wait()
+}
+
+// writeFinalCheckpoint writes a checkpoint at the end of a crawl, if checkpointing is enabled.
+func (sc *SiteCrawler) writeFinalCheckpoint() {
+	if sc.CheckpointPath == "" {
+		return
+	}
+	if err := sc.Checkpoint(); err != nil {
+		sc.Logger.Error("Failed to write final checkpoint: %v", err)
+	}
+}
+
 // startPostProcessingWorkers starts a pool of workers that will process tasks from the post-processing queue.
 func (sc *SiteCrawler) startPostProcessingWorkers(ctx context.Context) {
 	for i := 0; i < sc.WorkerPoolSize; i++ {
@@ -190,10 +659,38 @@ func (sc *SiteCrawler) startPostProcessingWorkers(ctx context.Context) {
 
 // PostProcessor defines an interface for post-processing tasks that can be applied to crawled pages.
 type PostProcessor interface {
-	Process(ctx context.Context, pageURL *url.URL, pageContent string) error
+	Process(ctx context.Context, page *CrawledPage) error
 }
 
+// CrawledPage is a successfully crawled page, as handed to post-processors.
+// Unchanged pages fetched conditionally in recrawl mode have a 304 Result with an empty body.
+type CrawledPage struct {
+	URL    *url.URL
+	Result *FetchResult
+	// Change is whether the page is new, changed or unchanged since it was last stored in the ValidatorStore
+	Change PageChange
+	// Canonical is the URL the page declares with <link rel="canonical">, canonicalised, or "" if it declares none
+	Canonical string
+	// Links are the resolved page links with their anchor text, rel values and position. Empty on a 304
+	Links []Link
+	// Assets are the resolved image, script and stylesheet links, if RecordAssets is set. Empty on a 304
+	Assets []Link
+	// NoIndex is set if the page's meta robots tags or X-Robots-Tag header ask for it not to be indexed
+	NoIndex bool
+	Robots  RobotsDirectives
+	// Sitemap is the sitemap entry the page was enqueued from, with its lastmod, changefreq, priority and, if
+	// RecordSitemapExtensions is set, extensions, or nil if the page was first found some other way
+	Sitemap *UrlEntry
+	// Source is how the page's URL was first discovered
+	Source URLSource
+}
+
+// LinkPolicy decides whether a page link found on a page should be followed. It sees the link's metadata, so it can
+// for example skip sponsored links or links in the footer.
+type LinkPolicy func(page *url.URL, link Link) bool
+
 // NewSiteCrawler creates a new SiteCrawler instance with the provided configuration.
+// If fetcher is nil an HTTPFetcher using DefaultHTTPFetcherConfig and the given user agent is created.
 func NewSiteCrawler(
 	ctx context.Context,
 	baseURL url.URL,
@@ -202,33 +699,67 @@ func NewSiteCrawler(
 	userAgent string,
 	workerPoolSize int,
 	postProcessors []PostProcessor,
+	fetcher Fetcher,
 ) (*SiteCrawler, error) {
+	return NewMultiSiteCrawler(ctx, []url.URL{baseURL}, logger, pageLoadTimeoutMilliseconds, userAgent, workerPoolSize, postProcessors, fetcher)
+}
+
+// NewMultiSiteCrawler creates a SiteCrawler that crawls from several seeds, which may be on different hosts, in one
+// run. The sites share the worker pool and post-processors, while robots.txt, politeness and stats are kept per host.
+// The robots.txt for each seed's host is fetched up front; other hosts' are fetched the first time they are seen.
+// If fetcher is nil an HTTPFetcher using DefaultHTTPFetcherConfig and the given user agent is created.
+func NewMultiSiteCrawler(
+	ctx context.Context,
+	seeds []url.URL,
+	logger Logger,
+	pageLoadTimeoutMilliseconds time.Duration,
+	userAgent string,
+	workerPoolSize int,
+	postProcessors []PostProcessor,
+	fetcher Fetcher,
+) (*SiteCrawler, error) {
+	if len(seeds) == 0 {
+		return nil, errors.New("at least one seed URL is required")
+	}
+	if fetcher == nil {
+		config := DefaultHTTPFetcherConfig()
+		config.UserAgent = userAgent
+		fetcher = NewHTTPFetcher(config)
+	}
 	sc := &SiteCrawler{
-		BaseURL:             baseURL,
+		BaseURL:             seeds[0],
+		Seeds:               seeds,
 		Logger:              logger,
 		TimeoutMilliseconds: pageLoadTimeoutMilliseconds,
 		UserAgent:           userAgent,
-		CrawlQueue:          make(chan func(), 100000), // I/O bound, large link trees clog up the queue
-		PostProcessQueue:    make(chan func(), 24),     // CPU bound, 12 cores (may need tweaking)
+		Frontier:            NewSpillingFrontier(defaultFrontierMemoryLimit, "", nil),
+		PostProcessQueue:    make(chan func(), 24), // CPU bound, 12 cores (may need tweaking)
 		WorkerPoolSize:      workerPoolSize,
+		RetryPolicy:         DefaultRetryPolicy(),
+		Throttle:            NewThrottle(workerPoolSize),
+		RateLimiter:         NewHostRateLimiter(RateLimit{}),
+		Canonicalizer:       DefaultCanonicalizer(),
+		RobotsTTL:           DefaultRobotsTTL,
+		RobotsErrorTTL:      DefaultRobotsErrorTTL,
+		SitemapLimits:       DefaultSitemapLimits(),
+		FeedPaths:           DefaultFeedPaths,
+		Stats:               NewCrawlStats(),
+		budget:              newCrawlBudget(),
 		postProcessors:      postProcessors,
+		Fetcher:             fetcher,
 		crawlWg:             &sync.WaitGroup{},
 		postProcessWg:       &sync.WaitGroup{},
 	}
 
-	robotsUrl, err := sc.BaseURL.Parse("/robots.txt")
-	if err != nil {
-		return nil, err
-	}
-	timeoutCtx, cancel := context.WithTimeout(ctx, sc.TimeoutMilliseconds*time.Millisecond)
-	robots, err := FetchPage(timeoutCtx, robotsUrl)
-	defer cancel()
-	robotsChecker, err := NewRobotsChecker(robots)
-	if err != nil {
-		return nil, err
+	for i := range sc.Seeds {
+		robotsChecker, err := sc.hostRobots(ctx, sc.canonicalSeed(i))
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			sc.RobotsChecker = robotsChecker
+		}
 	}
-
-	sc.RobotsChecker = robotsChecker
-	logger.Debug("New site crawler created for site %s", sc.BaseURL.String())
+	logger.Debug("New site crawler created for %s", seedList(sc.Seeds))
 	return sc, nil
 }
@@ -3,10 +3,14 @@ package main
 import (
 	"context"
 	"fmt"
+	"github.com/samber/lo"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"log"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"path/filepath"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -15,7 +19,7 @@ import (
 
 type DoNothingPostProcessor struct{}
 
-func (p *DoNothingPostProcessor) Process(ctx context.Context, pageURL *url.URL, content string) error {
+func (p *DoNothingPostProcessor) Process(ctx context.Context, page *CrawledPage) error {
 	return nil
 }
 
@@ -34,6 +38,7 @@ func TestNewSiteCrawler_SetsBaseValues(t *testing.T) {
 		"Crawler",
 		20,
 		[]PostProcessor{&DoNothingPostProcessor{}},
+		nil,
 	)
 	require.NoError(t, err)
 	require.NotNil(t, crawler)
@@ -44,7 +49,7 @@ func TestNewSiteCrawler_SetsBaseValues(t *testing.T) {
 	assert.Equal(t, 20, crawler.WorkerPoolSize)
 	assert.NotNil(t, crawler.RobotsChecker)
 	assert.NotNil(t, crawler.crawlWg)
-	assert.NotNil(t, crawler.CrawlQueue)
+	assert.NotNil(t, crawler.Frontier)
 	assert.NotNil(t, crawler.postProcessWg)
 	assert.NotNil(t, crawler.PostProcessQueue)
 	assert.Equal(t, []PostProcessor{&DoNothingPostProcessor{}}, crawler.postProcessors)
@@ -76,6 +81,7 @@ func TestNewSiteCrawler_ParsesAndReadsRobotsTxt(t *testing.T) {
 		"Crawler",
 		20,
 		[]PostProcessor{&DoNothingPostProcessor{}},
+		nil,
 	)
 	require.NoError(t, err)
 	require.NotNil(t, crawler)
@@ -109,6 +115,7 @@ func TestNewSiteCrawler_HandlesNoRobotsTxt(t *testing.T) {
 		"Crawler",
 		20,
 		[]PostProcessor{&DoNothingPostProcessor{}},
+		nil,
 	)
 	require.NoError(t, err)
 	require.NotNil(t, crawler)
@@ -118,13 +125,15 @@ func TestNewSiteCrawler_HandlesNoRobotsTxt(t *testing.T) {
 
 type SpyProcessor struct {
 	PageData  sync.Map
+	Pages     sync.Map
 	CallCount atomic.Int32
 }
 
-func (s *SpyProcessor) Process(ctx context.Context, pageURL *url.URL, pageContent string) error {
-	log.Printf("SpyProcessor processing page: %s", pageURL.String())
+func (s *SpyProcessor) Process(ctx context.Context, page *CrawledPage) error {
+	log.Printf("SpyProcessor processing page: %s", page.URL.String())
 	s.CallCount.Add(1)
-	s.PageData.Store(pageURL.String(), pageContent)
+	s.PageData.Store(page.URL.String(), page.Result.Body)
+	s.Pages.Store(page.URL.String(), page)
 	return nil
 }
 
@@ -156,13 +165,14 @@ func TestSiteCrawler_CrawlPage_SendsSuccessfulGETForPostProcessing(t *testing.T)
 		"Crawler",
 		20,
 		[]PostProcessor{spy},
+		nil,
 	)
 	require.NoError(t, err)
 
 	go crawler.startCrawlWorkers(context.Background())
 	go crawler.startPostProcessingWorkers(context.Background())
 	beansUrl := baseUrl.ResolveReference(&url.URL{Path: "/beans"})
-	crawler.CrawlPage(context.Background(), beansUrl)
+	crawler.CrawlPage(context.Background(), FrontierItem{URL: beansUrl.String()})
 
 	require.Eventually(t, func() bool {
 		_, ok := spy.PageData.Load(beansUrl.String())
@@ -208,6 +218,7 @@ func TestSiteCrawler_CrawlPage_ExitsGracefullyOnCtxClose(t *testing.T) {
 		"Crawler",
 		20,
 		[]PostProcessor{spy},
+		nil,
 	)
 	require.NoError(t, err)
 
@@ -215,7 +226,7 @@ func TestSiteCrawler_CrawlPage_ExitsGracefullyOnCtxClose(t *testing.T) {
 	go crawler.startPostProcessingWorkers(context.Background())
 
 	beansUrl := baseUrl.ResolveReference(&url.URL{Path: "/beans"})
-	crawler.CrawlPage(ctx, beansUrl)
+	crawler.CrawlPage(ctx, FrontierItem{URL: beansUrl.String()})
 	require.Eventually(t, func() bool {
 		_, ok := spy.PageData.Load(beansUrl.String())
 		return ok
@@ -223,7 +234,7 @@ func TestSiteCrawler_CrawlPage_ExitsGracefullyOnCtxClose(t *testing.T) {
 
 	cancel()
 	toastUrl := baseUrl.ResolveReference(&url.URL{Path: "/toast"})
-	crawler.CrawlPage(ctx, toastUrl)
+	crawler.CrawlPage(ctx, FrontierItem{URL: toastUrl.String()})
 
 	require.Never(t, func() bool {
 		_, ok := spy.PageData.Load(toastUrl.String())
@@ -265,6 +276,7 @@ func TestSiteCrawler_CrawlPage_SkipsProcessingFor404Urls(t *testing.T) {
 		"Crawler",
 		20,
 		[]PostProcessor{spy},
+		nil,
 	)
 	require.NoError(t, err)
 
@@ -272,14 +284,14 @@ func TestSiteCrawler_CrawlPage_SkipsProcessingFor404Urls(t *testing.T) {
 	go crawler.startPostProcessingWorkers(ctx)
 
 	beansUrl := baseUrl.ResolveReference(&url.URL{Path: "/beans"})
-	crawler.CrawlPage(ctx, beansUrl)
+	crawler.CrawlPage(ctx, FrontierItem{URL: beansUrl.String()})
 	require.Eventually(t, func() bool {
 		_, ok := spy.PageData.Load(beansUrl.String())
 		return ok
 	}, 2*time.Second, 10*time.Millisecond)
 
 	toastUrl := baseUrl.ResolveReference(&url.URL{Path: "/toast"})
-	crawler.CrawlPage(ctx, toastUrl)
+	crawler.CrawlPage(ctx, FrontierItem{URL: toastUrl.String()})
 
 	require.Never(t, func() bool {
 		_, ok := spy.PageData.Load(toastUrl.String())
@@ -322,6 +334,7 @@ func TestSiteCrawler_CrawlPage_EnqueuesAdditionalFoundPagesForCrawling(t *testin
 		"Crawler",
 		20,
 		[]PostProcessor{spy},
+		nil,
 	)
 	require.NoError(t, err)
 
@@ -329,7 +342,7 @@ func TestSiteCrawler_CrawlPage_EnqueuesAdditionalFoundPagesForCrawling(t *testin
 	go crawler.startPostProcessingWorkers(ctx)
 
 	beansUrl := baseUrl.ResolveReference(&url.URL{Path: "/beans"})
-	crawler.CrawlPage(ctx, beansUrl)
+	crawler.CrawlPage(ctx, FrontierItem{URL: beansUrl.String()})
 	require.Eventually(t, func() bool {
 		_, ok := spy.PageData.Load(beansUrl.String())
 		return ok
@@ -378,6 +391,7 @@ func TestSiteCrawler_AddURLToCrawlQueue_EnqueuesPageForCrawling(t *testing.T) {
 		"Crawler",
 		20,
 		[]PostProcessor{spy},
+		nil,
 	)
 	require.NoError(t, err)
 
@@ -385,7 +399,7 @@ func TestSiteCrawler_AddURLToCrawlQueue_EnqueuesPageForCrawling(t *testing.T) {
 	go crawler.startPostProcessingWorkers(ctx)
 
 	beansUrl := baseUrl.ResolveReference(&url.URL{Path: "/beans"})
-	crawler.AddURLToCrawlQueue(ctx, beansUrl)
+	crawler.AddURLToCrawlQueue(ctx, FrontierItem{URL: beansUrl.String()})
 	require.Eventually(t, func() bool {
 		_, ok := spy.PageData.Load(beansUrl.String())
 		return ok
@@ -432,6 +446,7 @@ func TestSiteCrawler_AddURLToCrawlQueue_WillNotCrawlIfRobotsDisallow(t *testing.
 		"Crawler",
 		20,
 		[]PostProcessor{spy},
+		nil,
 	)
 	require.NoError(t, err)
 
@@ -440,8 +455,8 @@ func TestSiteCrawler_AddURLToCrawlQueue_WillNotCrawlIfRobotsDisallow(t *testing.
 
 	beansUrl := baseUrl.ResolveReference(&url.URL{Path: "/beans"})
 	toastUrl := baseUrl.ResolveReference(&url.URL{Path: "/toast"})
-	crawler.AddURLToCrawlQueue(ctx, beansUrl)
-	crawler.AddURLToCrawlQueue(ctx, toastUrl)
+	crawler.AddURLToCrawlQueue(ctx, FrontierItem{URL: beansUrl.String()})
+	crawler.AddURLToCrawlQueue(ctx, FrontierItem{URL: toastUrl.String()})
 
 	require.Eventually(t, func() bool {
 		_, ok := spy.PageData.Load(toastUrl.String())
@@ -483,6 +498,7 @@ func TestSiteCrawler_AddURLToCrawlQueue_WillNotCrawlSamePageTwice(t *testing.T)
 		"Crawler",
 		20,
 		[]PostProcessor{spy},
+		nil,
 	)
 	require.NoError(t, err)
 
@@ -490,9 +506,9 @@ func TestSiteCrawler_AddURLToCrawlQueue_WillNotCrawlSamePageTwice(t *testing.T)
 	go crawler.startPostProcessingWorkers(ctx)
 
 	beansUrl := baseUrl.ResolveReference(&url.URL{Path: "/beans"})
-	crawler.AddURLToCrawlQueue(ctx, beansUrl)
-	crawler.AddURLToCrawlQueue(ctx, beansUrl)
-	crawler.AddURLToCrawlQueue(ctx, beansUrl)
+	crawler.AddURLToCrawlQueue(ctx, FrontierItem{URL: beansUrl.String()})
+	crawler.AddURLToCrawlQueue(ctx, FrontierItem{URL: beansUrl.String()})
+	crawler.AddURLToCrawlQueue(ctx, FrontierItem{URL: beansUrl.String()})
 
 	require.Eventually(t, func() bool {
 		_, ok := spy.PageData.Load(beansUrl.String())
@@ -519,11 +535,12 @@ func TestSiteCrawler_AddURLToCrawlQueue_DoesNotAddPageFromAnotherDomain(t *testi
 		"Crawler",
 		20,
 		[]PostProcessor{spy},
+		nil,
 	)
 	require.NoError(t, err)
 
 	externalUrl, _ := url.Parse("https://external.com/beans")
-	crawler.AddURLToCrawlQueue(ctx, externalUrl)
+	crawler.AddURLToCrawlQueue(ctx, FrontierItem{URL: externalUrl.String()})
 
 	require.Never(t, func() bool {
 		return spy.CallCount.Load() > 0
@@ -560,6 +577,7 @@ func TestSiteCrawler_AddURLToPostProcessQueue_AddsOneTaskPerProcessor(t *testing
 		"Crawler",
 		20,
 		[]PostProcessor{spy, spy2},
+		nil,
 	)
 	require.NoError(t, err)
 
@@ -567,7 +585,7 @@ func TestSiteCrawler_AddURLToPostProcessQueue_AddsOneTaskPerProcessor(t *testing
 	go crawler.startPostProcessingWorkers(ctx)
 
 	pageUrl := baseUrl.ResolveReference(&url.URL{Path: "/beans"})
-	crawler.AddURLToPostProcessQueue(ctx, pageUrl, "Hello, World!")
+	crawler.AddURLToPostProcessQueue(ctx, &CrawledPage{URL: pageUrl, Result: &FetchResult{Body: "Hello, World!"}})
 
 	require.Eventually(t, func() bool {
 		return spy.CallCount.Load() == 1
@@ -639,6 +657,7 @@ func TestSiteCrawler_CrawlFromSiteMap_CrawlsAllSitemapUrls(t *testing.T) {
 		"Crawler",
 		20,
 		[]PostProcessor{spy},
+		nil,
 	)
 	require.NoError(t, err)
 
@@ -691,6 +710,7 @@ func TestSiteCrawler_CrawlFromSiteMap_HandlesEmptySitemap(t *testing.T) {
 		"Crawler",
 		20,
 		[]PostProcessor{spy},
+		nil,
 	)
 	require.NoError(t, err)
 
@@ -728,6 +748,7 @@ func TestSiteCrawler_CrawlFromSiteMap_HandlesInvalidSitemap(t *testing.T) {
 		"Crawler",
 		20,
 		[]PostProcessor{spy},
+		nil,
 	)
 	require.NoError(t, err)
 
@@ -816,6 +837,7 @@ func TestSiteCrawler_Crawl_ExampleSite(t *testing.T) {
 		"Crawler",
 		20,
 		[]PostProcessor{spy},
+		nil,
 	)
 	require.NoError(t, err)
 
@@ -920,6 +942,7 @@ func TestSiteCrawler_Crawl_DeeplyNestedURLS(t *testing.T) {
 		"Crawler",
 		20,
 		[]PostProcessor{spy},
+		nil,
 	)
 	require.NoError(t, err)
 
@@ -932,3 +955,1248 @@ func TestSiteCrawler_Crawl_DeeplyNestedURLS(t *testing.T) {
 	require.True(t, ok, "expected orange juice page to be processed")
 	assert.Equal(t, `You found me, nice work!`, contentOrangeJuice, "expected orange juice page content to match")
 }
+
+// FakeFetcher serves pages from memory, keyed by path, and records every request made.
+type FakeFetcher struct {
+	Pages     map[string]string
+	Requested sync.Map
+}
+
+func (f *FakeFetcher) FetchPage(ctx context.Context, pageURL *url.URL) (*FetchResult, error) {
+	f.Requested.Store(pageURL.Path, struct{}{})
+	page, ok := f.Pages[pageURL.Path]
+	if !ok {
+		return nil, &httpError{StatusCode: 404, URL: pageURL.String()}
+	}
+	return &FetchResult{URL: pageURL, FinalURL: pageURL, StatusCode: 200, Body: page, ContentLength: int64(len(page))}, nil
+}
+
+func TestSiteCrawler_Crawl_CrawlsHostsWithUnderscores(t *testing.T) {
+	fetcher := &FakeFetcher{Pages: map[string]string{
+		"/":      `<body><a href="/toast">Toast</a></body>`,
+		"/toast": "Toast!",
+	}}
+	spy := &SpyProcessor{}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	crawler, err := NewSiteCrawler(ctx, *mustParse(t, "https://my_site.example.com/"), &StdoutLogger{}, 1000, "Crawler", 1, []PostProcessor{spy}, fetcher)
+	require.NoError(t, err)
+
+	require.NoError(t, crawler.Crawl(ctx))
+
+	assert.Equal(t, int32(2), spy.CallCount.Load())
+}
+
+func TestSiteCrawler_Crawl_UsesInjectedFetcher(t *testing.T) {
+	fetcher := &FakeFetcher{Pages: map[string]string{
+		"/robots.txt":  "User-agent: *\nAllow: /",
+		"/sitemap.xml": `<urlset><url><loc>/beans</loc></url></urlset>`,
+		"/":            `<body><a href="/toast">Toast</a></body>`,
+		"/beans":       "Beans!",
+		"/toast":       "Toast!",
+	}}
+	baseUrl, err := url.Parse("https://example.com/")
+	require.NoError(t, err)
+
+	spy := &SpyProcessor{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	crawler, err := NewSiteCrawler(
+		ctx,
+		*baseUrl,
+		&StdoutLogger{},
+		1000,
+		"Crawler",
+		20,
+		[]PostProcessor{spy},
+		fetcher,
+	)
+	require.NoError(t, err)
+	assert.Equal(t, fetcher, crawler.Fetcher)
+
+	err = crawler.Crawl(ctx)
+	require.NoError(t, err)
+
+	assert.Equal(t, int32(3), spy.CallCount.Load())
+	for _, path := range []string{"/robots.txt", "/sitemap.xml", "/", "/beans", "/toast"} {
+		_, ok := fetcher.Requested.Load(path)
+		assert.True(t, ok, "expected %s to be requested through the injected fetcher", path)
+	}
+}
+
+func TestSiteCrawler_CrawlPage_PassesFetchResultToPostProcessors(t *testing.T) {
+	testPages := []PageReturn{
+		{
+			URL:        "/beans",
+			HTML:       "Hello, World!",
+			StatusCode: 200,
+			Headers: map[string]string{
+				"Content-Type": "text/plain",
+				"X-Robots-Tag": "noarchive",
+			},
+		},
+	}
+	server := startTestServerPages(testPages)
+	defer server.Close()
+
+	baseUrl, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	spy := &SpyProcessor{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	crawler, err := NewSiteCrawler(
+		ctx,
+		*baseUrl,
+		&StdoutLogger{},
+		1000,
+		"Crawler",
+		20,
+		[]PostProcessor{spy},
+		nil,
+	)
+	require.NoError(t, err)
+
+	go crawler.startCrawlWorkers(ctx)
+	go crawler.startPostProcessingWorkers(ctx)
+
+	beansUrl := baseUrl.ResolveReference(&url.URL{Path: "/beans"})
+	crawler.CrawlPage(ctx, FrontierItem{URL: beansUrl.String()})
+
+	require.Eventually(t, func() bool {
+		_, ok := spy.Pages.Load(beansUrl.String())
+		return ok
+	}, 2*time.Second, 10*time.Millisecond)
+	stored, _ := spy.Pages.Load(beansUrl.String())
+	page := stored.(*CrawledPage)
+	assert.Equal(t, beansUrl, page.URL)
+	assert.Equal(t, 200, page.Result.StatusCode)
+	assert.Equal(t, "text/plain", page.Result.ContentType)
+	assert.Equal(t, "noarchive", page.Result.Header.Get("X-Robots-Tag"))
+	assert.Equal(t, int64(13), page.Result.ContentLength)
+}
+
+func TestSiteCrawler_CrawlPage_RetriesTransientFailures(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/flaky" {
+			http.NotFound(w, r)
+			return
+		}
+		if requests.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("Finally!"))
+	}))
+	defer server.Close()
+
+	baseUrl, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	spy := &SpyProcessor{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	crawler, err := NewSiteCrawler(
+		ctx,
+		*baseUrl,
+		&StdoutLogger{},
+		1000,
+		"Crawler",
+		20,
+		[]PostProcessor{spy},
+		nil,
+	)
+	require.NoError(t, err)
+	crawler.RetryPolicy.BaseDelay = time.Millisecond
+	crawler.RetryPolicy.MaxDelay = 10 * time.Millisecond
+
+	go crawler.startPostProcessingWorkers(ctx)
+
+	flakyUrl := baseUrl.ResolveReference(&url.URL{Path: "/flaky"})
+	crawler.CrawlPage(ctx, FrontierItem{URL: flakyUrl.String()})
+
+	require.Eventually(t, func() bool {
+		_, ok := spy.Pages.Load(flakyUrl.String())
+		return ok
+	}, 2*time.Second, 10*time.Millisecond)
+	stored, _ := spy.Pages.Load(flakyUrl.String())
+	page := stored.(*CrawledPage)
+	assert.Equal(t, "Finally!", page.Result.Body)
+	assert.Equal(t, 3, page.Result.Attempts)
+	assert.Equal(t, int32(3), requests.Load())
+}
+
+func TestSiteCrawler_CrawlPage_GivesUpAfterMaxAttempts(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/broken" {
+			requests.Add(1)
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	baseUrl, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	spy := &SpyProcessor{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	crawler, err := NewSiteCrawler(
+		ctx,
+		*baseUrl,
+		&StdoutLogger{},
+		1000,
+		"Crawler",
+		20,
+		[]PostProcessor{spy},
+		nil,
+	)
+	require.NoError(t, err)
+	crawler.RetryPolicy = RetryPolicy{MaxAttempts: 4, BaseDelay: time.Millisecond, RetryableStatusCodes: []int{500}}
+
+	go crawler.startPostProcessingWorkers(ctx)
+
+	brokenUrl := baseUrl.ResolveReference(&url.URL{Path: "/broken"})
+	crawler.CrawlPage(ctx, FrontierItem{URL: brokenUrl.String()})
+
+	assert.Equal(t, int32(4), requests.Load())
+	assert.Equal(t, int32(0), spy.CallCount.Load())
+}
+
+func TestSiteCrawler_CrawlPage_HonoursRetryAfter(t *testing.T) {
+	var requestTimes []time.Time
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/busy" {
+			http.NotFound(w, r)
+			return
+		}
+		mu.Lock()
+		requestTimes = append(requestTimes, time.Now())
+		first := len(requestTimes) == 1
+		mu.Unlock()
+		if first {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte("Ready now"))
+	}))
+	defer server.Close()
+
+	baseUrl, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	spy := &SpyProcessor{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	crawler, err := NewSiteCrawler(
+		ctx,
+		*baseUrl,
+		&StdoutLogger{},
+		1000,
+		"Crawler",
+		4,
+		[]PostProcessor{spy},
+		nil,
+	)
+	require.NoError(t, err)
+	crawler.RetryPolicy.BaseDelay = time.Millisecond
+
+	go crawler.startPostProcessingWorkers(ctx)
+
+	busyUrl := baseUrl.ResolveReference(&url.URL{Path: "/busy"})
+	crawler.CrawlPage(ctx, FrontierItem{URL: busyUrl.String()})
+
+	require.Eventually(t, func() bool {
+		_, ok := spy.Pages.Load(busyUrl.String())
+		return ok
+	}, 3*time.Second, 10*time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, requestTimes, 2)
+	assert.GreaterOrEqual(t, requestTimes[1].Sub(requestTimes[0]), 900*time.Millisecond)
+	assert.Less(t, crawler.Throttle.Concurrency(baseUrl.Host), 4)
+}
+
+func TestSiteCrawler_CrawlPage_CapsRetryAfterAtMaxPause(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/busy" {
+			http.NotFound(w, r)
+			return
+		}
+		if requests.Add(1) == 1 {
+			w.Header().Set("Retry-After", "86400")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("Ready now"))
+	}))
+	defer server.Close()
+
+	baseUrl, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	spy := &SpyProcessor{}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	crawler, err := NewSiteCrawler(ctx, *baseUrl, &StdoutLogger{}, 1000, "Crawler", 1, []PostProcessor{spy}, nil)
+	require.NoError(t, err)
+	crawler.RetryPolicy.BaseDelay = time.Millisecond
+	crawler.Throttle.MaxPause = 50 * time.Millisecond
+
+	go crawler.startPostProcessingWorkers(ctx)
+
+	busyUrl := baseUrl.ResolveReference(&url.URL{Path: "/busy"})
+	crawler.CrawlPage(ctx, FrontierItem{URL: busyUrl.String()})
+
+	require.NoError(t, ctx.Err())
+	assert.Equal(t, int32(2), requests.Load())
+	require.Eventually(t, func() bool {
+		_, ok := spy.Pages.Load(busyUrl.String())
+		return ok
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestNewSiteCrawler_RateLimitsFromRobotsCrawlDelay(t *testing.T) {
+	testPages := []PageReturn{
+		{
+			URL:        "/robots.txt",
+			HTML:       "User-agent: *\nCrawl-delay: 0.2",
+			StatusCode: 200,
+		},
+		{
+			URL:        "/sitemap.xml",
+			HTML:       `<urlset><url><loc>/beans</loc></url><url><loc>/toast</loc></url></urlset>`,
+			StatusCode: 200,
+		},
+		{
+			URL:        "/beans",
+			HTML:       "Beans!",
+			StatusCode: 200,
+		},
+		{
+			URL:        "/toast",
+			HTML:       "Toast!",
+			StatusCode: 200,
+		},
+	}
+	server := startTestServerPages(testPages)
+	defer server.Close()
+
+	baseUrl, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	spy := &SpyProcessor{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	crawler, err := NewSiteCrawler(
+		ctx,
+		*baseUrl,
+		&StdoutLogger{},
+		1000,
+		"Crawler",
+		20,
+		[]PostProcessor{spy},
+		nil,
+	)
+	require.NoError(t, err)
+	assert.Equal(t, RateLimit{RequestsPerSecond: 5, Burst: 1}, crawler.RateLimiter.LimitFor(baseUrl.Host))
+
+	start := time.Now()
+	err = crawler.Crawl(ctx)
+	require.NoError(t, err)
+
+	// sitemap, /beans, /toast and / are all paced by the crawl delay once the initial token is spent
+	assert.Equal(t, int32(2), spy.CallCount.Load())
+	assert.GreaterOrEqual(t, time.Since(start), 500*time.Millisecond)
+}
+
+func TestSiteCrawler_Crawl_SpillsLargeLinkTreesWithoutDeadlocking(t *testing.T) {
+	links := ""
+	testPages := []PageReturn{}
+	for i := 0; i < 50; i++ {
+		links += fmt.Sprintf(`<a href="/page-%d">Page %d</a>`, i, i)
+		testPages = append(testPages, PageReturn{
+			URL:        fmt.Sprintf("/page-%d", i),
+			HTML:       fmt.Sprintf(`<body><a href="/page-%d">Next</a></body>`, (i+1)%50),
+			StatusCode: 200,
+		})
+	}
+	testPages = append(testPages, PageReturn{URL: "/hub", HTML: "<body>" + links + "</body>", StatusCode: 200})
+	testPages = append(testPages, PageReturn{URL: "/sitemap.xml", HTML: `<urlset><url><loc>/hub</loc></url></urlset>`, StatusCode: 200})
+	server := startTestServerPages(testPages)
+	defer server.Close()
+
+	baseUrl, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	spy := &SpyProcessor{}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	crawler, err := NewSiteCrawler(
+		ctx,
+		*baseUrl,
+		&StdoutLogger{},
+		1000,
+		"Crawler",
+		2,
+		[]PostProcessor{spy},
+		nil,
+	)
+	require.NoError(t, err)
+	crawler.Frontier = NewSpillingFrontier(3, t.TempDir(), nil)
+
+	err = crawler.Crawl(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int32(51), spy.CallCount.Load())
+}
+
+func TestSiteCrawler_Crawl_ReturnsWhenContextCancelled(t *testing.T) {
+	testPages := []PageReturn{
+		{URL: "/sitemap.xml", HTML: `<urlset><url><loc>/slow-1</loc></url><url><loc>/slow-2</loc></url><url><loc>/slow-3</loc></url></urlset>`, StatusCode: 200},
+		{URL: "/slow-1", HTML: "slow", StatusCode: 200, DelayMilliseconds: 500},
+		{URL: "/slow-2", HTML: "slow", StatusCode: 200, DelayMilliseconds: 500},
+		{URL: "/slow-3", HTML: "slow", StatusCode: 200, DelayMilliseconds: 500},
+	}
+	server := startTestServerPages(testPages)
+	defer server.Close()
+
+	baseUrl, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	crawler, err := NewSiteCrawler(
+		ctx,
+		*baseUrl,
+		&StdoutLogger{},
+		1000,
+		"Crawler",
+		1,
+		[]PostProcessor{&DoNothingPostProcessor{}},
+		nil,
+	)
+	require.NoError(t, err)
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+	}()
+
+	start := time.Now()
+	err = crawler.Crawl(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestSiteCrawler_Crawl_FetchesInPriorityOrder(t *testing.T) {
+	var fetched []string
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fetched = append(fetched, r.URL.Path)
+		mu.Unlock()
+		w.Write([]byte("page"))
+	}))
+	defer server.Close()
+
+	baseUrl, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	crawler, err := NewSiteCrawler(
+		ctx,
+		*baseUrl,
+		&StdoutLogger{},
+		1000,
+		"Crawler",
+		1,
+		[]PostProcessor{&DoNothingPostProcessor{}},
+		nil,
+	)
+	require.NoError(t, err)
+	go crawler.startPostProcessingWorkers(ctx)
+
+	resolve := func(path string) string {
+		return baseUrl.ResolveReference(&url.URL{Path: path}).String()
+	}
+	crawler.AddURLToCrawlQueue(ctx, FrontierItem{URL: resolve("/deep"), Depth: 2})
+	crawler.AddURLToCrawlQueue(ctx, FrontierItem{URL: resolve("/linked"), Depth: 1})
+	crawler.AddURLToCrawlQueue(ctx, FrontierItem{URL: resolve("/sitemap-low"), Sitemap: &UrlEntry{Priority: floatPtr(0.2)}})
+	crawler.AddURLToCrawlQueue(ctx, FrontierItem{URL: resolve("/sitemap-high"), Sitemap: &UrlEntry{Priority: floatPtr(0.9)}})
+
+	mu.Lock()
+	fetched = nil
+	mu.Unlock()
+	crawler.startCrawlWorkers(ctx)
+	crawler.crawlWg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"/sitemap-high", "/sitemap-low", "/linked", "/deep"}, fetched)
+}
+
+func TestSiteCrawler_Crawl_EnforcesCrawlLimits(t *testing.T) {
+	testPages := []PageReturn{
+		{URL: "/sitemap.xml", HTML: `<urlset></urlset>`, StatusCode: 200},
+		{URL: "/{$}", HTML: `<body><a href="/level-1">1</a><a href="/news/a">a</a><a href="/news/b">b</a><a href="/news/c">c</a></body>`, StatusCode: 200},
+		{URL: "/level-1", HTML: `<body><a href="/level-2">2</a></body>`, StatusCode: 200},
+		{URL: "/level-2", HTML: `<body><a href="/level-3">3</a></body>`, StatusCode: 200},
+		{URL: "/level-3", HTML: `Too deep`, StatusCode: 200},
+		{URL: "/news/a", HTML: `News`, StatusCode: 200},
+		{URL: "/news/b", HTML: `News`, StatusCode: 200},
+		{URL: "/news/c", HTML: `News`, StatusCode: 200},
+	}
+	server := startTestServerPages(testPages)
+	defer server.Close()
+
+	baseUrl, err := url.Parse(server.URL + "/")
+	require.NoError(t, err)
+
+	spy := &SpyProcessor{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	crawler, err := NewSiteCrawler(
+		ctx,
+		*baseUrl,
+		&StdoutLogger{},
+		1000,
+		"Crawler",
+		1,
+		[]PostProcessor{spy},
+		nil,
+	)
+	require.NoError(t, err)
+	crawler.Limits = CrawlLimits{
+		MaxDepth:    2,
+		PathBudgets: map[string]int{"/news/": 2},
+	}
+
+	err = crawler.Crawl(ctx)
+	require.NoError(t, err)
+
+	assert.Equal(t, int32(5), spy.CallCount.Load(), "expected /, /level-1, /level-2 and two /news/ pages")
+	_, ok := spy.PageData.Load(baseUrl.ResolveReference(&url.URL{Path: "/level-3"}).String())
+	assert.False(t, ok, "expected /level-3 to be beyond the max depth")
+
+	stats := crawler.Stats.Snapshot()
+	assert.Equal(t, int64(6), stats.PagesEnqueued, "the third /news/ page is only refused when it is taken from the frontier")
+	assert.Equal(t, int64(5), stats.PagesCrawled)
+	assert.Equal(t, int64(1), stats.Skipped[SkipMaxDepth])
+	assert.Equal(t, int64(1), stats.Skipped[SkipPathBudget])
+}
+
+func TestSiteCrawler_Crawl_EnforcesMaxPagesAndBytes(t *testing.T) {
+	links := ""
+	testPages := []PageReturn{{URL: "/sitemap.xml", HTML: `<urlset></urlset>`, StatusCode: 200}}
+	for i := 0; i < 10; i++ {
+		links += fmt.Sprintf(`<a href="/page-%d">%d</a>`, i, i)
+		testPages = append(testPages, PageReturn{URL: fmt.Sprintf("/page-%d", i), HTML: "0123456789", StatusCode: 200})
+	}
+	testPages = append(testPages, PageReturn{URL: "/{$}", HTML: "<body>" + links + "</body>", StatusCode: 200})
+	server := startTestServerPages(testPages)
+	defer server.Close()
+
+	baseUrl, err := url.Parse(server.URL + "/")
+	require.NoError(t, err)
+
+	for _, tt := range []struct {
+		name     string
+		limits   CrawlLimits
+		expected int32
+		reason   SkipReason
+	}{
+		{name: "max pages", limits: CrawlLimits{MaxPages: 4}, expected: 4, reason: SkipMaxPages},
+		{name: "max bytes", limits: CrawlLimits{MaxBytes: 20}, expected: 1, reason: SkipMaxBytes},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			spy := &SpyProcessor{}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			crawler, err := NewSiteCrawler(
+				ctx,
+				*baseUrl,
+				&StdoutLogger{},
+				1000,
+				"Crawler",
+				1,
+				[]PostProcessor{spy},
+				nil,
+			)
+			require.NoError(t, err)
+			crawler.Limits = tt.limits
+
+			err = crawler.Crawl(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, spy.CallCount.Load())
+			assert.Greater(t, crawler.Stats.Snapshot().Skipped[tt.reason], int64(0))
+		})
+	}
+}
+
+func TestSiteCrawler_Crawl_MaxPagesKeepsTheHighestPriorityPages(t *testing.T) {
+	var fetched []string
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fetched = append(fetched, r.URL.Path)
+		mu.Unlock()
+		w.Write([]byte("page"))
+	}))
+	defer server.Close()
+
+	baseUrl, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	crawler, err := NewSiteCrawler(
+		ctx,
+		*baseUrl,
+		&StdoutLogger{},
+		1000,
+		"Crawler",
+		1,
+		[]PostProcessor{&DoNothingPostProcessor{}},
+		nil,
+	)
+	require.NoError(t, err)
+	crawler.Limits.MaxPages = 2
+	go crawler.startPostProcessingWorkers(ctx)
+
+	resolve := func(path string) string {
+		return baseUrl.ResolveReference(&url.URL{Path: path}).String()
+	}
+	// Discovered lowest priority first, which would have used up the budget if it was claimed on discovery
+	crawler.AddURLToCrawlQueue(ctx, FrontierItem{URL: resolve("/deep"), Depth: 2})
+	crawler.AddURLToCrawlQueue(ctx, FrontierItem{URL: resolve("/linked"), Depth: 1})
+	crawler.AddURLToCrawlQueue(ctx, FrontierItem{URL: resolve("/sitemap-high"), Sitemap: &UrlEntry{Priority: floatPtr(0.9)}})
+	mu.Lock()
+	fetched = nil
+	mu.Unlock()
+	crawler.startCrawlWorkers(ctx)
+	crawler.crawlWg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"/sitemap-high", "/linked"}, fetched)
+	assert.Equal(t, int64(1), crawler.Stats.Snapshot().Skipped[SkipMaxPages])
+}
+
+func TestSiteCrawler_Crawl_FailedFetchesDontCountTowardsMaxPages(t *testing.T) {
+	server := startTestServerPages([]PageReturn{
+		{URL: "/sitemap.xml", HTML: `<urlset></urlset>`, StatusCode: 200},
+		{URL: "/{$}", HTML: `<body><a href="/missing-1">1</a><a href="/missing-2">2</a><a href="/page">p</a></body>`, StatusCode: 200},
+		{URL: "/page", HTML: `Page`, StatusCode: 200},
+	})
+	defer server.Close()
+
+	baseUrl, err := url.Parse(server.URL + "/")
+	require.NoError(t, err)
+
+	spy := &SpyProcessor{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	crawler, err := NewSiteCrawler(
+		ctx,
+		*baseUrl,
+		&StdoutLogger{},
+		1000,
+		"Crawler",
+		1,
+		[]PostProcessor{spy},
+		nil,
+	)
+	require.NoError(t, err)
+	crawler.Limits.MaxPages = 2
+
+	err = crawler.Crawl(ctx)
+	require.NoError(t, err)
+
+	_, ok := spy.PageData.Load(baseUrl.ResolveReference(&url.URL{Path: "/page"}).String())
+	assert.True(t, ok, "the 404s shouldn't have used up the page budget")
+	assert.Equal(t, int64(0), crawler.Stats.Snapshot().Skipped[SkipMaxPages])
+}
+
+func TestSiteCrawler_Crawl_ResumesFromCheckpointWithoutRefetching(t *testing.T) {
+	var crawler *SiteCrawler
+	var hits sync.Map
+	pages := map[string]string{
+		"/":  `<body><a href="/a">a</a><a href="/b">b</a></body>`,
+		"/a": `<body><a href="/c">c</a></body>`,
+		"/b": `<body><a href="/d">d</a></body>`,
+		"/c": `C`,
+		"/d": `D`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		count, _ := hits.LoadOrStore(r.URL.Path, &atomic.Int32{})
+		count.(*atomic.Int32).Add(1)
+		if r.URL.Path == "/a" {
+			// Pause once /a is being fetched, it will finish but nothing new will start
+			crawler.Pause()
+		}
+		w.Write([]byte(page))
+	}))
+	defer server.Close()
+
+	baseUrl, err := url.Parse(server.URL + "/")
+	require.NoError(t, err)
+	checkpointPath := filepath.Join(t.TempDir(), "crawl.checkpoint")
+
+	firstSpy := &SpyProcessor{}
+	ctx, cancel := context.WithCancel(context.Background())
+	crawler, err = NewSiteCrawler(ctx, *baseUrl, &StdoutLogger{}, 1000, "Crawler", 1, []PostProcessor{firstSpy}, nil)
+	require.NoError(t, err)
+	crawler.CheckpointPath = checkpointPath
+	crawler.CheckpointInterval = 10 * time.Millisecond
+
+	crawlErr := make(chan error)
+	go func() {
+		crawlErr <- crawler.Crawl(ctx)
+	}()
+	aUrl := baseUrl.ResolveReference(&url.URL{Path: "/a"}).String()
+	require.Eventually(t, func() bool {
+		_, ok := crawler.processedPages.Load(aUrl)
+		return ok
+	}, 2*time.Second, 10*time.Millisecond)
+	cancel()
+	require.ErrorIs(t, <-crawlErr, context.Canceled)
+
+	checkpoint, err := LoadCheckpoint(checkpointPath)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{baseUrl.String(), aUrl}, checkpoint.Processed)
+	assert.Len(t, checkpoint.Pending, 2, "expected /b and /c to be pending")
+
+	secondSpy := &SpyProcessor{}
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	defer cancel2()
+	resumed, err := NewSiteCrawler(ctx2, *baseUrl, &StdoutLogger{}, 1000, "Crawler", 2, []PostProcessor{secondSpy}, nil)
+	require.NoError(t, err)
+	require.NoError(t, resumed.RestoreCheckpoint(checkpointPath))
+	require.NoError(t, resumed.Crawl(ctx2))
+
+	assert.Equal(t, int32(3), secondSpy.CallCount.Load(), "expected only /b, /c and /d to be crawled after resuming")
+	for path := range pages {
+		count, ok := hits.Load(path)
+		require.True(t, ok, "expected %s to be fetched", path)
+		assert.Equal(t, int32(1), count.(*atomic.Int32).Load(), "expected %s to be fetched exactly once", path)
+	}
+	assert.Equal(t, int64(5), resumed.Stats.Snapshot().PagesCrawled, "stats carry over from the checkpoint")
+}
+
+func TestSiteCrawler_PauseStopsNewPagesUntilResumed(t *testing.T) {
+	server := startTestServerPages([]PageReturn{
+		{URL: "/beans", HTML: "Beans", StatusCode: 200},
+	})
+	defer server.Close()
+
+	baseUrl, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	spy := &SpyProcessor{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	crawler, err := NewSiteCrawler(ctx, *baseUrl, &StdoutLogger{}, 1000, "Crawler", 2, []PostProcessor{spy}, nil)
+	require.NoError(t, err)
+
+	go crawler.startPostProcessingWorkers(ctx)
+	crawler.startCrawlWorkers(ctx)
+	crawler.Pause()
+
+	beansUrl := baseUrl.ResolveReference(&url.URL{Path: "/beans"})
+	crawler.AddURLToCrawlQueue(ctx, FrontierItem{URL: beansUrl.String()})
+
+	require.Never(t, func() bool {
+		return spy.CallCount.Load() > 0
+	}, 200*time.Millisecond, 10*time.Millisecond, "no page should be crawled while paused")
+
+	crawler.Resume()
+	require.Eventually(t, func() bool {
+		return spy.CallCount.Load() == 1
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestSiteCrawler_Crawl_StopsPausedWorkersWhenFinished(t *testing.T) {
+	var crawler *SiteCrawler
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		// The last page pauses the crawl, so the workers are paused when it finishes
+		crawler.Pause()
+		w.Write([]byte("Beans"))
+	}))
+	defer server.Close()
+
+	baseUrl, err := url.Parse(server.URL + "/")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	crawler, err = NewSiteCrawler(ctx, *baseUrl, &StdoutLogger{}, 1000, "Crawler", 3, []PostProcessor{&SpyProcessor{}}, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, crawler.Crawl(ctx))
+
+	stopped := make(chan struct{})
+	go func() {
+		crawler.workersWg.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("crawl workers still running after the crawl finished")
+	}
+}
+
+func TestSiteCrawler_Crawl_RecrawlUsesConditionalRequests(t *testing.T) {
+	type versionedPage struct {
+		etag string
+		html string
+	}
+	var mu sync.Mutex
+	pages := map[string]versionedPage{
+		"/":      {etag: `"root-1"`, html: `<body><a href="/beans">Beans</a><a href="/toast">Toast</a></body>`},
+		"/beans": {etag: `"beans-1"`, html: "Beans"},
+		"/toast": {html: "Toast"}, // No ETag, so only the content hash can tell it hasn't changed
+	}
+	var notModified atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		page, ok := pages[r.URL.Path]
+		mu.Unlock()
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if page.etag != "" {
+			w.Header().Set("ETag", page.etag)
+			if r.Header.Get("If-None-Match") == page.etag {
+				notModified.Add(1)
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+		w.Write([]byte(page.html))
+	}))
+	defer server.Close()
+
+	baseUrl, err := url.Parse(server.URL + "/")
+	require.NoError(t, err)
+	storePath := filepath.Join(t.TempDir(), "validators.json")
+
+	crawl := func() *SpyProcessor {
+		spy := &SpyProcessor{}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		crawler, err := NewSiteCrawler(ctx, *baseUrl, &StdoutLogger{}, 1000, "Crawler", 2, []PostProcessor{spy}, nil)
+		require.NoError(t, err)
+		crawler.ValidatorStore, err = NewFileValidatorStore(storePath)
+		require.NoError(t, err)
+		crawler.Recrawl = true
+		require.NoError(t, crawler.Crawl(ctx))
+		return spy
+	}
+	changeOf := func(spy *SpyProcessor, path string) PageChange {
+		page, ok := spy.Pages.Load(baseUrl.ResolveReference(&url.URL{Path: path}).String())
+		require.True(t, ok, "expected %s to be processed", path)
+		return page.(*CrawledPage).Change
+	}
+
+	first := crawl()
+	assert.Equal(t, int32(3), first.CallCount.Load())
+	for _, path := range []string{"/", "/beans", "/toast"} {
+		assert.Equal(t, PageNew, changeOf(first, path), path)
+	}
+	assert.Equal(t, int32(0), notModified.Load())
+
+	mu.Lock()
+	pages["/beans"] = versionedPage{etag: `"beans-2"`, html: "More beans"}
+	mu.Unlock()
+
+	second := crawl()
+	assert.Equal(t, int32(3), second.CallCount.Load(), "links on a 304 page are still followed")
+	assert.Equal(t, PageUnchanged, changeOf(second, "/"))
+	assert.Equal(t, PageChanged, changeOf(second, "/beans"))
+	assert.Equal(t, PageUnchanged, changeOf(second, "/toast"))
+	assert.Equal(t, int32(1), notModified.Load(), "only the root page should have been revalidated with a 304")
+}
+
+func TestSiteCrawler_Crawl_FollowsPageLinksOfEveryKindAndRecordsAssets(t *testing.T) {
+	fetcher := &FakeFetcher{Pages: map[string]string{
+		"/": `<head><meta http-equiv="refresh" content="0; url=/refresh"><link rel="stylesheet" href="/style.css"></head>
+			<body><iframe src="/iframe"></iframe><map><area href="/area"></map><img src="/img.png" srcset="/img@2x.png 2x"></body>`,
+		"/refresh": "Refresh",
+		"/iframe":  "Iframe",
+		"/area":    "Area",
+	}}
+	baseUrl, err := url.Parse("https://example.com/")
+	require.NoError(t, err)
+
+	spy := &SpyProcessor{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	crawler, err := NewSiteCrawler(ctx, *baseUrl, &StdoutLogger{}, 1000, "Crawler", 4, []PostProcessor{spy}, fetcher)
+	require.NoError(t, err)
+	crawler.RecordAssets = true
+	require.NoError(t, crawler.Crawl(ctx))
+
+	assert.Equal(t, int32(4), spy.CallCount.Load())
+	for _, path := range []string{"/refresh", "/iframe", "/area"} {
+		_, ok := spy.PageData.Load("https://example.com" + path)
+		assert.True(t, ok, "expected %s to be crawled", path)
+	}
+	for _, path := range []string{"/style.css", "/img.png", "/img@2x.png"} {
+		_, requested := fetcher.Requested.Load(path)
+		assert.False(t, requested, "assets should not be fetched: %s", path)
+	}
+
+	root, ok := spy.Pages.Load("https://example.com/")
+	require.True(t, ok)
+	assert.Equal(t, []Link{
+		{URL: "https://example.com/style.css", Kind: LinkStylesheet},
+		{URL: "https://example.com/img.png", Kind: LinkImage},
+		{URL: "https://example.com/img@2x.png", Kind: LinkImage},
+	}, urlsAndKinds(root.(*CrawledPage).Assets))
+}
+
+func TestSiteCrawler_CrawlPage_ResolvesLinksAgainstThePageAndBaseHref(t *testing.T) {
+	server := startTestServerPages([]PageReturn{
+		{URL: "/guides/intro/start", HTML: `<a href="../about">About</a><a href="next">Next</a>`, StatusCode: 200},
+		{URL: "/with-base/page", HTML: `<head><base href="/docs/v2/"></head><a href="install">Install</a>`, StatusCode: 200},
+	})
+	defer server.Close()
+
+	baseUrl, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	crawler, err := NewSiteCrawler(ctx, *baseUrl, &StdoutLogger{}, 1000, "Crawler", 1, []PostProcessor{}, nil)
+	require.NoError(t, err)
+
+	enqueued := func() []string {
+		items, err := crawler.Frontier.Snapshot()
+		require.NoError(t, err)
+		return lo.Map(items, func(item FrontierItem, _ int) string { return item.URL })
+	}
+
+	crawler.CrawlPage(ctx, FrontierItem{URL: server.URL + "/guides/intro/start"})
+	assert.ElementsMatch(t, []string{server.URL + "/guides/about", server.URL + "/guides/intro/next"}, enqueued())
+
+	crawler.CrawlPage(ctx, FrontierItem{URL: server.URL + "/with-base/page"})
+	assert.Contains(t, enqueued(), server.URL+"/docs/v2/install")
+}
+
+func TestSiteCrawler_CrawlPage_ResolvesLinksAgainstTheRedirectTarget(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/old/start", http.RedirectHandler("/new/start", http.StatusMovedPermanently))
+	mux.HandleFunc("/new/start", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<a href="sibling">Sibling</a>`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	baseUrl, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	crawler, err := NewSiteCrawler(ctx, *baseUrl, &StdoutLogger{}, 1000, "Crawler", 1, []PostProcessor{}, nil)
+	require.NoError(t, err)
+
+	crawler.CrawlPage(ctx, FrontierItem{URL: server.URL + "/old/start"})
+	items, err := crawler.Frontier.Snapshot()
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Equal(t, server.URL+"/new/sibling", items[0].URL)
+}
+
+func TestSiteCrawler_Crawl_AppliesLinkPolicyAndExposesLinkMetadata(t *testing.T) {
+	fetcher := &FakeFetcher{Pages: map[string]string{
+		"/": `<body>
+			<main><a href="/article">Read the article</a></main>
+			<a href="/partner" rel="sponsored">Partner</a>
+			<footer><a href="/terms">Terms</a></footer>
+		</body>`,
+		"/article": "Article",
+		"/partner": "Partner",
+		"/terms":   "Terms",
+	}}
+	baseUrl, err := url.Parse("https://example.com/")
+	require.NoError(t, err)
+
+	spy := &SpyProcessor{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	crawler, err := NewSiteCrawler(ctx, *baseUrl, &StdoutLogger{}, 1000, "Crawler", 2, []PostProcessor{spy}, fetcher)
+	require.NoError(t, err)
+	var policyPages sync.Map
+	crawler.LinkPolicy = func(page *url.URL, link Link) bool {
+		policyPages.Store(page.String(), struct{}{})
+		return !link.HasRel("sponsored") && link.Section != SectionFooter
+	}
+	require.NoError(t, crawler.Crawl(ctx))
+
+	assert.Equal(t, int32(2), spy.CallCount.Load(), "expected only / and /article to be crawled")
+	_, requested := fetcher.Requested.Load("/partner")
+	assert.False(t, requested)
+	_, requested = fetcher.Requested.Load("/terms")
+	assert.False(t, requested)
+	_, ok := policyPages.Load("https://example.com/")
+	assert.True(t, ok, "the policy is given the page the link was found on")
+	assert.Equal(t, int64(2), crawler.Stats.Snapshot().Skipped[SkipLinkPolicy])
+
+	root, ok := spy.Pages.Load("https://example.com/")
+	require.True(t, ok)
+	links := root.(*CrawledPage).Links
+	require.Len(t, links, 3, "post-processors see every link, followed or not")
+	assert.Equal(t, Link{URL: "https://example.com/article", Kind: LinkAnchor, Text: "Read the article", Section: SectionMain}, links[0])
+	assert.Equal(t, []string{"sponsored"}, links[1].Rel)
+	assert.Equal(t, 2, links[2].Position)
+}
+
+func TestSiteCrawler_Crawl_RespectsRobotsDirectives(t *testing.T) {
+	server := startTestServerPages([]PageReturn{
+		{URL: "/{$}", HTML: `<a href="/sponsored" rel="nofollow">Sponsored</a><a href="/meta">Meta</a><a href="/header">Header</a>`, StatusCode: 200},
+		{URL: "/sponsored", HTML: "Sponsored", StatusCode: 200},
+		{URL: "/meta", HTML: `<head><meta name="robots" content="noindex, nofollow"></head><a href="/from-meta">Hidden</a>`, StatusCode: 200},
+		{URL: "/from-meta", HTML: "Hidden", StatusCode: 200},
+		{URL: "/header", HTML: `<a href="/from-header">Hidden</a>`, StatusCode: 200, Headers: map[string]string{"X-Robots-Tag": "crawler: nofollow"}},
+		{URL: "/from-header", HTML: "Hidden", StatusCode: 200},
+	})
+	defer server.Close()
+	baseUrl, err := url.Parse(server.URL + "/")
+	require.NoError(t, err)
+
+	crawl := func(respect bool) (*SiteCrawler, *SpyProcessor) {
+		spy := &SpyProcessor{}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		crawler, err := NewSiteCrawler(ctx, *baseUrl, &StdoutLogger{}, 1000, "Crawler", 2, []PostProcessor{spy}, nil)
+		require.NoError(t, err)
+		crawler.RespectRobotsDirectives = respect
+		require.NoError(t, crawler.Crawl(ctx))
+		return crawler, spy
+	}
+
+	crawler, spy := crawl(true)
+	assert.Equal(t, int32(3), spy.CallCount.Load(), "expected only /, /meta and /header to be crawled")
+	assert.Equal(t, int64(3), crawler.Stats.Snapshot().Skipped[SkipNoFollow])
+	meta, ok := spy.Pages.Load(server.URL + "/meta")
+	require.True(t, ok)
+	assert.True(t, meta.(*CrawledPage).NoIndex)
+	header, ok := spy.Pages.Load(server.URL + "/header")
+	require.True(t, ok)
+	assert.Equal(t, RobotsDirectives{NoFollow: true}, header.(*CrawledPage).Robots)
+	assert.False(t, header.(*CrawledPage).NoIndex)
+
+	_, spy = crawl(false)
+	assert.Equal(t, int32(6), spy.CallCount.Load(), "directives are only followed when opted in to")
+	meta, ok = spy.Pages.Load(server.URL + "/meta")
+	require.True(t, ok)
+	assert.True(t, meta.(*CrawledPage).NoIndex, "noindex is reported either way")
+}
+
+func TestSiteCrawler_Crawl_DeduplicatesCanonicalURLs(t *testing.T) {
+	fetcher := &FakeFetcher{Pages: map[string]string{
+		"/": `<a href="/beans?utm_source=newsletter">Beans</a>
+			<a href="HTTPS://EXAMPLE.COM:443/beans">Beans again</a>
+			<a href="/%62eans#top">Beans once more</a>
+			<a href="/docs/">Docs</a>`,
+		"/beans": "Beans",
+		"/docs/": "Docs",
+	}}
+	baseUrl, err := url.Parse("https://example.com/")
+	require.NoError(t, err)
+
+	spy := &SpyProcessor{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	crawler, err := NewSiteCrawler(ctx, *baseUrl, &StdoutLogger{}, 1000, "Crawler", 2, []PostProcessor{spy}, fetcher)
+	require.NoError(t, err)
+	require.NoError(t, crawler.Crawl(ctx))
+
+	assert.Equal(t, int32(3), spy.CallCount.Load())
+	for _, pageURL := range []string{"https://example.com/", "https://example.com/beans", "https://example.com/docs/"} {
+		_, ok := spy.PageData.Load(pageURL)
+		assert.True(t, ok, "expected %s to be crawled under its canonical URL", pageURL)
+	}
+}
+
+func TestSiteCrawler_Crawl_DeduplicatesPagesByRelCanonical(t *testing.T) {
+	fetcher := &FakeFetcher{Pages: map[string]string{
+		"/":      `<a href="/shoes?colour=red">Red shoes</a><a href="/shoes?colour=blue">Blue shoes</a><a href="/shoes">Shoes</a>`,
+		"/shoes": `<head><link rel="canonical" href="https://EXAMPLE.com/shoes#main"></head>Shoes`,
+	}}
+	baseUrl, err := url.Parse("https://example.com/")
+	require.NoError(t, err)
+
+	spy := &SpyProcessor{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	crawler, err := NewSiteCrawler(ctx, *baseUrl, &StdoutLogger{}, 1000, "Crawler", 1, []PostProcessor{spy}, fetcher)
+	require.NoError(t, err)
+	require.NoError(t, crawler.Crawl(ctx))
+
+	assert.Equal(t, int32(2), spy.CallCount.Load(), "expected / and one of the three shoe pages to be processed")
+	assert.Equal(t, int64(2), crawler.Stats.Snapshot().Skipped[SkipCanonical])
+	assert.Equal(t, int64(4), crawler.Stats.Snapshot().PagesCrawled, "duplicates are still crawled")
+	assert.Equal(t, map[string]string{
+		"https://example.com/shoes?colour=red":  "https://example.com/shoes",
+		"https://example.com/shoes?colour=blue": "https://example.com/shoes",
+	}, crawler.CanonicalAliases())
+
+	var processed *CrawledPage
+	spy.Pages.Range(func(key, value any) bool {
+		if key.(string) != "https://example.com/" {
+			processed = value.(*CrawledPage)
+		}
+		return true
+	})
+	require.NotNil(t, processed)
+	assert.Equal(t, "https://example.com/shoes", processed.Canonical)
+}
+
+func TestSiteCrawler_Crawl_AppliesURLFilter(t *testing.T) {
+	fetcher := &FakeFetcher{Pages: map[string]string{
+		"/":                `<a href="/docs/intro">Intro</a><a href="/docs/manual.pdf">Manual</a><a href="/shop">Shop</a>`,
+		"/docs/intro":      `<a href="/docs/advanced?print=1">Print</a>`,
+		"/docs/manual.pdf": "%PDF",
+		"/shop":            "Shop",
+	}}
+	baseUrl, err := url.Parse("https://example.com/")
+	require.NoError(t, err)
+
+	spy := &SpyProcessor{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	crawler, err := NewSiteCrawler(ctx, *baseUrl, &StdoutLogger{}, 1000, "Crawler", 2, []PostProcessor{spy}, fetcher)
+	require.NoError(t, err)
+	glob, err := GlobRule("/")
+	require.NoError(t, err)
+	crawler.Filter = &URLFilter{
+		Allow: []URLRule{glob, PathPrefixRule("/docs/")},
+		Deny:  []URLRule{ExtensionRule(DefaultDeniedExtensions...), QueryParamRule("print")},
+	}
+	require.NoError(t, crawler.Crawl(ctx))
+
+	assert.Equal(t, int32(2), spy.CallCount.Load(), "expected only / and /docs/intro to be crawled")
+	rejections := crawler.Filter.Rejections()
+	assert.Equal(t, int64(1), rejections["query:print"])
+	assert.Equal(t, int64(1), rejections["allow:none"])
+	assert.Len(t, rejections, 3)
+	assert.Equal(t, int64(3), crawler.Stats.Snapshot().Skipped[SkipFiltered])
+}
+
+func TestSiteCrawler_Crawl_FollowsSubdomainsInScope(t *testing.T) {
+	fetcher := &FakeFetcher{Pages: map[string]string{
+		"/":     `<a href="https://www.example.com/www">WWW</a><a href="https://blog.example.com/blog">Blog</a><a href="https://other.com/other">Other</a>`,
+		"/www":  "WWW",
+		"/blog": "Blog",
+	}}
+	baseUrl, err := url.Parse("https://example.com/")
+	require.NoError(t, err)
+
+	crawl := func(scope Scope) *SpyProcessor {
+		spy := &SpyProcessor{}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		crawler, err := NewSiteCrawler(ctx, *baseUrl, &StdoutLogger{}, 1000, "Crawler", 2, []PostProcessor{spy}, fetcher)
+		require.NoError(t, err)
+		crawler.Scope = scope
+		require.NoError(t, crawler.Crawl(ctx))
+		return spy
+	}
+
+	assert.Equal(t, int32(1), crawl(Scope{}).CallCount.Load(), "the default scope is the exact host")
+	assert.Equal(t, int32(2), crawl(Scope{WWWEquivalent: true}).CallCount.Load())
+	spy := crawl(Scope{Mode: ScopeSubdomains})
+	assert.Equal(t, int32(3), spy.CallCount.Load())
+	_, ok := spy.PageData.Load("https://blog.example.com/blog")
+	assert.True(t, ok)
+}
+
+func TestNewMultiSiteCrawler_RequiresASeed(t *testing.T) {
+	_, err := NewMultiSiteCrawler(context.Background(), nil, &StdoutLogger{}, 1000, "Crawler", 1, nil, &FakeFetcher{})
+	assert.Error(t, err)
+}
+
+func TestSiteCrawler_Crawl_CrawlsMultipleSeedsWithPerHostRobotsAndStats(t *testing.T) {
+	first := startTestServerPages([]PageReturn{
+		{URL: "/robots.txt", HTML: "User-agent: *\nCrawl-delay: 0.01", StatusCode: 200},
+		{URL: "/{$}", HTML: `<body><a href="/beans">Beans</a></body>`, StatusCode: 200},
+		{URL: "/beans", HTML: "Beans!", StatusCode: 200},
+	})
+	defer first.Close()
+	second := startTestServerPages([]PageReturn{
+		{URL: "/sitemap.xml", HTML: `<urlset><url><loc>/toast</loc></url></urlset>`, StatusCode: 200},
+		{URL: "/{$}", HTML: "Home", StatusCode: 200},
+		{URL: "/toast", HTML: "Toast!", StatusCode: 200},
+	})
+	defer second.Close()
+
+	firstURL, err := url.Parse(first.URL + "/")
+	require.NoError(t, err)
+	secondURL, err := url.Parse(second.URL + "/")
+	require.NoError(t, err)
+
+	spy := &SpyProcessor{}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	crawler, err := NewMultiSiteCrawler(ctx, []url.URL{*firstURL, *secondURL}, &StdoutLogger{}, 1000, "Crawler", 2, []PostProcessor{spy}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, *firstURL, crawler.BaseURL)
+	assert.Equal(t, 100.0, crawler.RateLimiter.LimitFor(firstURL.Host).RequestsPerSecond)
+	assert.Equal(t, RateLimit{}, crawler.RateLimiter.LimitFor(secondURL.Host))
+
+	require.NoError(t, crawler.Crawl(ctx))
+
+	for _, page := range []string{first.URL + "/", first.URL + "/beans", second.URL + "/", second.URL + "/toast"} {
+		_, ok := spy.PageData.Load(page)
+		assert.True(t, ok, "expected %s to be crawled", page)
+	}
+	assert.Equal(t, int32(4), spy.CallCount.Load())
+
+	stats := crawler.Stats.Snapshot()
+	assert.Equal(t, int64(4), stats.PagesCrawled)
+	assert.Equal(t, int64(2), stats.Hosts[firstURL.Host].PagesCrawled)
+	assert.Equal(t, int64(2), stats.Hosts[secondURL.Host].PagesCrawled)
+}
+
+func TestSiteCrawler_AddURLToCrawlQueue_KeepsToTheSeedsScopes(t *testing.T) {
+	fetcher := &FakeFetcher{Pages: map[string]string{}}
+	seeds := []url.URL{*mustParse(t, "https://a.example/"), *mustParse(t, "https://b.example/")}
+	crawler, err := NewMultiSiteCrawler(context.Background(), seeds, &StdoutLogger{}, 1000, "Crawler", 1, nil, fetcher)
+	require.NoError(t, err)
+
+	crawler.AddURLToCrawlQueue(context.Background(), FrontierItem{URL: "https://a.example/page"})
+	crawler.AddURLToCrawlQueue(context.Background(), FrontierItem{URL: "https://b.example/page"})
+	crawler.AddURLToCrawlQueue(context.Background(), FrontierItem{URL: "https://c.example/page"})
+
+	assert.Equal(t, 2, crawler.Frontier.Len())
+	stats := crawler.Stats.Snapshot()
+	assert.Equal(t, int64(1), stats.Hosts["c.example"].Skipped[SkipOutOfScope])
+}
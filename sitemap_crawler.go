@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrSitemapTooDeep  = errors.New("sitemap index nesting exceeds the maximum depth")
+	ErrTooManySitemaps = errors.New("maximum number of sitemaps reached")
+)
+
+// SitemapLimits bounds how far the crawler follows sitemap indexes. Zero values mean unlimited, except Concurrency
+// which is at least one.
+type SitemapLimits struct {
+	MaxDepth    int           // Maximum nesting of sitemap indexes below a root sitemap
+	MaxSitemaps int           // Maximum number of sitemaps fetched in total
+	Concurrency int           // Number of sitemaps fetched at once
+	MaxBytes    int64         // Maximum size of a sitemap, both as received and after decompression
+	Timeout     time.Duration // Maximum time to download a sitemap. The page timeout only covers its response headers
+}
+
+// DefaultSitemapLimits returns the sitemap limits the crawler uses unless told otherwise.
+func DefaultSitemapLimits() SitemapLimits {
+	// 50MB is the most the sitemaps protocol allows in one uncompressed sitemap, which takes a few minutes on a slow link
+	return SitemapLimits{MaxDepth: 3, MaxSitemaps: 1000, Concurrency: 4, MaxBytes: 50 * 1024 * 1024, Timeout: 5 * time.Minute}
+}
+
+// SitemapReport describes a sitemap the crawler fetched, or tried to.
+type SitemapReport struct {
+	URL      string
+	Depth    int   // 0 for a root sitemap, 1 for a sitemap listed in a root sitemap index, and so on
+	URLs     int   // Number of page URLs the sitemap listed
+	Sitemaps int   // Number of child sitemaps the sitemap listed, if it is a sitemap index
+	Err      error // Why the sitemap couldn't be fetched, parsed or followed, if it failed
+}
+
+// SitemapReports returns a report for every sitemap found so far, sorted by URL.
+func (sc *SiteCrawler) SitemapReports() []SitemapReport {
+	sc.sitemapMu.Lock()
+	defer sc.sitemapMu.Unlock()
+	reports := slices.Clone(sc.sitemapReports)
+	slices.SortFunc(reports, func(a, b SitemapReport) int {
+		return strings.Compare(a.URL, b.URL)
+	})
+	return reports
+}
+
+// recordSitemap stores the report for a sitemap.
+func (sc *SiteCrawler) recordSitemap(report SitemapReport) {
+	if report.Err != nil {
+		sc.Logger.Warn("Failed to crawl sitemap %s: %v", report.URL, report.Err)
+	} else {
+		sc.Logger.Debug("Sitemap %s listed %d URLs and %d sitemaps", report.URL, report.URLs, report.Sitemaps)
+	}
+	sc.sitemapMu.Lock()
+	defer sc.sitemapMu.Unlock()
+	sc.sitemapReports = append(sc.sitemapReports, report)
+}
+
+// CrawlFromSiteMap reads the sitemaps of each seed's site, following sitemap indexes within the SitemapLimits, and
+// adds the URLs they list to the crawl queue. A site's sitemaps are the ones its robots.txt declares in Sitemap:
+// directives, or /sitemap.xml if it declares none; ExtraSitemapURLs are read as well. What was found in each sitemap
+// is available from SitemapReports.
+func (sc *SiteCrawler) CrawlFromSiteMap(ctx context.Context) error {
+	sc.walkSitemaps(ctx, sc.sitemapRoots(ctx))
+	return nil
+}
+
+// sitemapRoots returns the sitemaps to start reading from, canonicalised and without duplicates.
+func (sc *SiteCrawler) sitemapRoots(ctx context.Context) []*url.URL {
+	var roots []*url.URL
+	seen := make(map[string]struct{})
+	add := func(base *url.URL, rawURL string) {
+		resolved, err := ResolveAndCleanURL(base, strings.TrimSpace(rawURL))
+		if err == nil {
+			resolved, err = sc.Canonicalizer.Canonicalize(resolved)
+		}
+		if err == nil && !resolved.IsAbs() {
+			err = errors.New("not an absolute URL")
+		}
+		if err != nil {
+			sc.recordSitemap(SitemapReport{URL: rawURL, Err: fmt.Errorf("invalid sitemap URL: %w", err)})
+			return
+		}
+		if _, ok := seen[resolved.String()]; ok {
+			return
+		}
+		seen[resolved.String()] = struct{}{}
+		roots = append(roots, resolved)
+	}
+
+	for i := range sc.Seeds {
+		seed := sc.canonicalSeed(i)
+		declared := sc.robotsFor(ctx, seed).Sitemaps()
+		if len(declared) == 0 {
+			declared = []string{"/sitemap.xml"}
+		}
+		for _, sitemap := range declared {
+			add(seed, sitemap)
+		}
+	}
+	for _, sitemap := range sc.ExtraSitemapURLs {
+		add(&url.URL{}, sitemap)
+	}
+	return roots
+}
+
+// sitemapWalk is one pass through a site's sitemaps, following sitemap indexes within the SitemapLimits.
+type sitemapWalk struct {
+	sc    *SiteCrawler
+	wg    sync.WaitGroup
+	slots chan struct{}
+	mu    sync.Mutex
+	seen  map[string]struct{}
+}
+
+// walkSitemaps fetches the given root sitemaps and everything they lead to, returning once they have all been read.
+func (sc *SiteCrawler) walkSitemaps(ctx context.Context, roots []*url.URL) {
+	walk := &sitemapWalk{
+		sc:    sc,
+		slots: make(chan struct{}, max(sc.SitemapLimits.Concurrency, 1)),
+		seen:  make(map[string]struct{}),
+	}
+	for _, root := range roots {
+		walk.visit(ctx, root, 0)
+	}
+	walk.wg.Wait()
+}
+
+// visit starts reading a sitemap in the background, unless it has already been visited or a limit has been reached.
+func (w *sitemapWalk) visit(ctx context.Context, sitemapURL *url.URL, depth int) {
+	limits := w.sc.SitemapLimits
+	if limits.MaxDepth > 0 && depth > limits.MaxDepth {
+		w.sc.recordSitemap(SitemapReport{URL: sitemapURL.String(), Depth: depth, Err: ErrSitemapTooDeep})
+		return
+	}
+	w.mu.Lock()
+	if _, seen := w.seen[sitemapURL.String()]; seen {
+		w.mu.Unlock()
+		return
+	}
+	if limits.MaxSitemaps > 0 && len(w.seen) >= limits.MaxSitemaps {
+		w.mu.Unlock()
+		w.sc.recordSitemap(SitemapReport{URL: sitemapURL.String(), Depth: depth, Err: ErrTooManySitemaps})
+		return
+	}
+	w.seen[sitemapURL.String()] = struct{}{}
+	w.mu.Unlock()
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		select {
+		case w.slots <- struct{}{}:
+		case <-ctx.Done():
+			w.sc.recordSitemap(SitemapReport{URL: sitemapURL.String(), Depth: depth, Err: ctx.Err()})
+			return
+		}
+		children := w.sc.readSitemap(ctx, sitemapURL, depth)
+		<-w.slots
+		for _, child := range children {
+			w.visit(ctx, child, depth+1)
+		}
+	}()
+}
+
+// readSitemap fetches and parses a sitemap as it downloads, adds the page URLs it lists to the crawl queue and returns the child
+// sitemaps it lists. Sitemaps may be XML, gzip compressed or plain text. Relative URLs are resolved against the
+// sitemap's own URL.
+func (sc *SiteCrawler) readSitemap(ctx context.Context, sitemapURL *url.URL, depth int) []*url.URL {
+	report := SitemapReport{URL: sitemapURL.String(), Depth: depth}
+	_, body, err := sc.fetchStream(ctx, sitemapURL, sc.SitemapLimits.Timeout)
+	if err != nil {
+		report.Err = err
+		sc.recordSitemap(report)
+		return nil
+	}
+	parsed, err := ParseSitemapReader(body, sc.SitemapLimits.MaxBytes)
+	body.Close()
+	if err != nil {
+		report.Err = err
+		sc.recordSitemap(report)
+		return nil
+	}
+
+	for _, entry := range parsed.URLs {
+		fullURL, err := ResolveAndCleanURL(sitemapURL, entry.Loc)
+		if err != nil {
+			sc.Logger.Warn("Skipping invalid URL in sitemap %s: %s", sitemapURL.String(), entry.Loc)
+			continue
+		}
+		report.URLs++
+		if !sc.RecordSitemapExtensions {
+			entry = entry.withoutExtensions()
+		}
+		sc.AddURLToCrawlQueue(ctx, FrontierItem{URL: fullURL.String(), Source: SourceSitemap, Sitemap: &entry})
+	}
+	var children []*url.URL
+	for _, entry := range parsed.Sitemaps {
+		child, err := ResolveAndCleanURL(sitemapURL, entry.Loc)
+		if err != nil {
+			sc.Logger.Warn("Skipping invalid sitemap URL in sitemap index %s: %s", sitemapURL.String(), entry.Loc)
+			continue
+		}
+		children = append(children, child)
+	}
+	report.Sitemaps = len(children)
+	sc.recordSitemap(report)
+	return children
+}
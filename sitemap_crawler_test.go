@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newSitemapTestCrawler(t *testing.T, pages map[string]string) (*SiteCrawler, *FakeFetcher) {
+	t.Helper()
+	fetcher := &FakeFetcher{Pages: pages}
+	crawler, err := NewSiteCrawler(context.Background(), *mustParse(t, "https://example.com/"), &StdoutLogger{}, 1000, "Crawler", 1, nil, fetcher)
+	require.NoError(t, err)
+	crawler.RetryPolicy.MaxAttempts = 1
+	return crawler, fetcher
+}
+
+// frontierURLs drains the crawler's frontier, returning the paths of the URLs that were in it.
+func frontierURLs(t *testing.T, crawler *SiteCrawler) []string {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	var paths []string
+	for crawler.Frontier.Len() > 0 {
+		item, ok := crawler.Frontier.Pop(ctx)
+		require.True(t, ok)
+		parsed, err := url.Parse(item.URL)
+		require.NoError(t, err)
+		paths = append(paths, parsed.Path)
+	}
+	return paths
+}
+
+func TestSiteCrawler_CrawlFromSiteMap_FollowsSitemapIndexes(t *testing.T) {
+	crawler, _ := newSitemapTestCrawler(t, map[string]string{
+		"/sitemap.xml": `<sitemapindex>
+			<sitemap><loc>/sitemaps/index-2.xml</loc></sitemap>
+			<sitemap><loc>https://example.com/sitemaps/pages.xml</loc></sitemap>
+			<sitemap><loc>/sitemaps/missing.xml</loc></sitemap>
+		</sitemapindex>`,
+		"/sitemaps/index-2.xml": `<sitemapindex><sitemap><loc>news.xml</loc></sitemap><sitemap><loc>/sitemap.xml</loc></sitemap></sitemapindex>`,
+		"/sitemaps/news.xml":    `<urlset><url><loc>/news/1</loc></url><url><loc>/news/2</loc></url></urlset>`,
+		"/sitemaps/pages.xml":   `<urlset><url><loc>/about</loc></url></urlset>`,
+	})
+
+	require.NoError(t, crawler.CrawlFromSiteMap(context.Background()))
+
+	assert.ElementsMatch(t, []string{"/news/1", "/news/2", "/about"}, frontierURLs(t, crawler))
+	reports := crawler.SitemapReports()
+	require.Len(t, reports, 5)
+	assert.Equal(t, SitemapReport{URL: "https://example.com/sitemap.xml", Depth: 0, Sitemaps: 3}, reports[0])
+	assert.Equal(t, SitemapReport{URL: "https://example.com/sitemaps/index-2.xml", Depth: 1, Sitemaps: 2}, reports[1])
+	assert.Equal(t, "https://example.com/sitemaps/missing.xml", reports[2].URL)
+	assert.Error(t, reports[2].Err)
+	assert.Equal(t, SitemapReport{URL: "https://example.com/sitemaps/news.xml", Depth: 2, URLs: 2}, reports[3])
+	assert.Equal(t, SitemapReport{URL: "https://example.com/sitemaps/pages.xml", Depth: 1, URLs: 1}, reports[4])
+}
+
+func TestSiteCrawler_CrawlFromSiteMap_StopsAtMaxDepth(t *testing.T) {
+	crawler, fetcher := newSitemapTestCrawler(t, map[string]string{
+		"/sitemap.xml": `<sitemapindex><sitemap><loc>/level-1.xml</loc></sitemap></sitemapindex>`,
+		"/level-1.xml": `<sitemapindex><sitemap><loc>/level-2.xml</loc></sitemap></sitemapindex>`,
+		"/level-2.xml": `<urlset><url><loc>/deep</loc></url></urlset>`,
+	})
+	crawler.SitemapLimits.MaxDepth = 1
+
+	require.NoError(t, crawler.CrawlFromSiteMap(context.Background()))
+
+	assert.Empty(t, frontierURLs(t, crawler))
+	_, requested := fetcher.Requested.Load("/level-2.xml")
+	assert.False(t, requested)
+	reports := crawler.SitemapReports()
+	require.Len(t, reports, 3)
+	assert.Equal(t, SitemapReport{URL: "https://example.com/level-2.xml", Depth: 2, Err: ErrSitemapTooDeep}, reports[1])
+}
+
+func TestSiteCrawler_CrawlFromSiteMap_StopsAtMaxSitemaps(t *testing.T) {
+	crawler, _ := newSitemapTestCrawler(t, map[string]string{
+		"/sitemap.xml": `<sitemapindex>
+			<sitemap><loc>/a.xml</loc></sitemap>
+			<sitemap><loc>/b.xml</loc></sitemap>
+			<sitemap><loc>/c.xml</loc></sitemap>
+		</sitemapindex>`,
+		"/a.xml": `<urlset><url><loc>/a</loc></url></urlset>`,
+		"/b.xml": `<urlset><url><loc>/b</loc></url></urlset>`,
+		"/c.xml": `<urlset><url><loc>/c</loc></url></urlset>`,
+	})
+	crawler.SitemapLimits = SitemapLimits{MaxSitemaps: 3, Concurrency: 2}
+
+	require.NoError(t, crawler.CrawlFromSiteMap(context.Background()))
+
+	assert.ElementsMatch(t, []string{"/a", "/b"}, frontierURLs(t, crawler))
+	reports := crawler.SitemapReports()
+	require.Len(t, reports, 4)
+	assert.Equal(t, SitemapReport{URL: "https://example.com/c.xml", Depth: 1, Err: ErrTooManySitemaps}, reports[2])
+}
+
+func TestSiteCrawler_CrawlFromSiteMap_ReadsSitemapsFromRobotsAndExtras(t *testing.T) {
+	crawler, fetcher := newSitemapTestCrawler(t, map[string]string{
+		"/robots.txt":         "User-agent: *\nAllow: /\nSitemap: https://example.com/sitemaps/pages.xml\nSitemap: https://EXAMPLE.com:443/sitemaps/pages.xml\nSitemap: /sitemaps/news.xml\n",
+		"/sitemaps/pages.xml": `<urlset><url><loc>/about</loc></url></urlset>`,
+		"/sitemaps/news.xml":  `<urlset><url><loc>/news/1</loc></url></urlset>`,
+		"/extra.xml":          `<urlset><url><loc>/extra</loc></url></urlset>`,
+	})
+	crawler.ExtraSitemapURLs = []string{"https://example.com/extra.xml", "https://example.com/sitemaps/news.xml", "/relative.xml"}
+
+	require.NoError(t, crawler.CrawlFromSiteMap(context.Background()))
+
+	assert.ElementsMatch(t, []string{"/about", "/news/1", "/extra"}, frontierURLs(t, crawler))
+	_, requested := fetcher.Requested.Load("/sitemap.xml")
+	assert.False(t, requested, "/sitemap.xml is only a fallback when robots.txt declares no sitemaps")
+	reports := crawler.SitemapReports()
+	require.Len(t, reports, 4)
+	assert.Equal(t, "/relative.xml", reports[0].URL)
+	assert.Error(t, reports[0].Err)
+	for _, report := range reports[1:] {
+		assert.NoError(t, report.Err)
+		assert.Equal(t, 1, report.URLs)
+	}
+}
+
+func TestSiteCrawler_CrawlFromSiteMap_ReadsGzipAndTextSitemaps(t *testing.T) {
+	crawler, _ := newSitemapTestCrawler(t, map[string]string{
+		"/sitemap.xml":    `<sitemapindex><sitemap><loc>/sitemap.xml.gz</loc></sitemap><sitemap><loc>/sitemap.txt</loc></sitemap></sitemapindex>`,
+		"/sitemap.xml.gz": gzipString(t, `<urlset><url><loc>/compressed</loc></url></urlset>`),
+		"/sitemap.txt":    "https://example.com/plain-1\nhttps://example.com/plain-2\n",
+	})
+
+	require.NoError(t, crawler.CrawlFromSiteMap(context.Background()))
+
+	assert.ElementsMatch(t, []string{"/compressed", "/plain-1", "/plain-2"}, frontierURLs(t, crawler))
+}
+
+func TestSiteCrawler_Crawl_PassesSitemapEntriesToPostProcessors(t *testing.T) {
+	fetcher := &FakeFetcher{Pages: map[string]string{
+		"/sitemap.xml": `<urlset><url><loc>/story</loc><lastmod>2024-03-01</lastmod><changefreq>hourly</changefreq></url></urlset>`,
+		"/":            `<body><a href="/linked">Linked</a></body>`,
+		"/story":       "Story",
+		"/linked":      "Linked",
+	}}
+	spy := &SpyProcessor{}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	crawler, err := NewSiteCrawler(ctx, *mustParse(t, "https://example.com/"), &StdoutLogger{}, 1000, "Crawler", 2, []PostProcessor{spy}, fetcher)
+	require.NoError(t, err)
+
+	require.NoError(t, crawler.Crawl(ctx))
+
+	story, ok := spy.Pages.Load("https://example.com/story")
+	require.True(t, ok)
+	require.NotNil(t, story.(*CrawledPage).Sitemap)
+	assert.Equal(t, "hourly", story.(*CrawledPage).Sitemap.ChangeFreq)
+	lastMod, ok := story.(*CrawledPage).Sitemap.LastModified()
+	assert.True(t, ok)
+	assert.Equal(t, 2024, lastMod.Year())
+
+	linked, ok := spy.Pages.Load("https://example.com/linked")
+	require.True(t, ok)
+	assert.Nil(t, linked.(*CrawledPage).Sitemap)
+}
+
+func TestSiteCrawler_CrawlFromSiteMap_CapsTransparentlyDecompressedSitemaps(t *testing.T) {
+	// Served with Content-Encoding: gzip, so the HTTP transport decompresses it before the sitemap parser sees it
+	bomb := gzipString(t, "<urlset>"+strings.Repeat("<url><loc>/page</loc></url>", 100_000)+"</urlset>")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/sitemap.xml" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write([]byte(bomb))
+	}))
+	defer server.Close()
+
+	crawler, err := NewSiteCrawler(context.Background(), *mustParse(t, server.URL+"/"), &StdoutLogger{}, 1000, "Crawler", 1, nil, nil)
+	require.NoError(t, err)
+	crawler.SitemapLimits.MaxBytes = 64 * 1024
+
+	require.NoError(t, crawler.CrawlFromSiteMap(context.Background()))
+
+	reports := crawler.SitemapReports()
+	require.Len(t, reports, 1)
+	assert.ErrorIs(t, reports[0].Err, ErrSitemapTooLarge)
+	assert.LessOrEqual(t, crawler.Stats.BytesDownloaded(), int64(64*1024+4096), "the body is streamed, not read in full")
+}
+
+// startSlowSitemapServer serves a sitemap whose body takes delay to arrive after the response headers.
+func startSlowSitemapServer(delay time.Duration) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/sitemap.xml" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("<urlset>"))
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(delay):
+		}
+		w.Write([]byte("<url><loc>/page</loc></url></urlset>"))
+	}))
+}
+
+func TestSiteCrawler_CrawlFromSiteMap_PageTimeoutOnlyCoversResponseHeaders(t *testing.T) {
+	server := startSlowSitemapServer(300 * time.Millisecond)
+	defer server.Close()
+
+	crawler, err := NewSiteCrawler(context.Background(), *mustParse(t, server.URL+"/"), &StdoutLogger{}, 100, "Crawler", 1, nil, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, crawler.CrawlFromSiteMap(context.Background()))
+
+	reports := crawler.SitemapReports()
+	require.Len(t, reports, 1)
+	assert.NoError(t, reports[0].Err)
+	assert.Equal(t, []string{"/page"}, frontierURLs(t, crawler))
+}
+
+func TestSiteCrawler_CrawlFromSiteMap_StopsAtSitemapTimeout(t *testing.T) {
+	server := startSlowSitemapServer(time.Second)
+	defer server.Close()
+
+	crawler, err := NewSiteCrawler(context.Background(), *mustParse(t, server.URL+"/"), &StdoutLogger{}, 1000, "Crawler", 1, nil, nil)
+	require.NoError(t, err)
+	crawler.SitemapLimits.Timeout = 100 * time.Millisecond
+
+	start := time.Now()
+	require.NoError(t, crawler.CrawlFromSiteMap(context.Background()))
+
+	reports := crawler.SitemapReports()
+	require.Len(t, reports, 1)
+	assert.Error(t, reports[0].Err)
+	assert.Less(t, time.Since(start), 900*time.Millisecond)
+	assert.Empty(t, frontierURLs(t, crawler))
+}
+
+func TestSiteCrawler_CrawlFromSiteMap_RetriesSitemapsWithoutResponseHeaders(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/sitemap.xml" {
+			http.NotFound(w, r)
+			return
+		}
+		if requests.Add(1) == 1 {
+			<-r.Context().Done()
+			return
+		}
+		w.Write([]byte("<urlset><url><loc>/page</loc></url></urlset>"))
+	}))
+	defer server.Close()
+
+	crawler, err := NewSiteCrawler(context.Background(), *mustParse(t, server.URL+"/"), &StdoutLogger{}, 100, "Crawler", 1, nil, nil)
+	require.NoError(t, err)
+	crawler.RetryPolicy.BaseDelay = time.Millisecond
+
+	require.NoError(t, crawler.CrawlFromSiteMap(context.Background()))
+
+	assert.Equal(t, int32(2), requests.Load())
+	assert.Equal(t, []string{"/page"}, frontierURLs(t, crawler))
+}
+
+func TestSiteCrawler_CrawlFromSiteMap_KeepsExtensionsOnlyWhenRecorded(t *testing.T) {
+	for _, record := range []bool{false, true} {
+		crawler, _ := newSitemapTestCrawler(t, map[string]string{
+			"/sitemap.xml": `<urlset><url>
+				<loc>/story</loc><priority>0.9</priority>
+				<image:image><image:loc>/story.jpg</image:loc></image:image>
+			</url></urlset>`,
+		})
+		crawler.RecordSitemapExtensions = record
+
+		require.NoError(t, crawler.CrawlFromSiteMap(context.Background()))
+
+		item, ok := crawler.Frontier.Pop(context.Background())
+		require.True(t, ok)
+		require.NotNil(t, item.Sitemap)
+		require.NotNil(t, item.Sitemap.Priority)
+		assert.Equal(t, 0.9, *item.Sitemap.Priority)
+		if record {
+			assert.Equal(t, []SitemapImage{{Loc: "/story.jpg"}}, item.Sitemap.Images)
+		} else {
+			assert.Empty(t, item.Sitemap.Images)
+		}
+	}
+}
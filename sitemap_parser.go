@@ -1,30 +1,314 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
 	"encoding/xml"
+	"errors"
 	"github.com/samber/lo"
+	"io"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// ErrSitemapTooLarge is returned when a sitemap, after decompression, is bigger than the size limit.
+var ErrSitemapTooLarge = errors.New("sitemap exceeds the maximum size")
+
 type UrlSet struct {
 	URLs []UrlEntry `xml:"url"`
 }
 
+// UrlEntry is a page listed in a sitemap, with its optional metadata. Extension elements (image:, video:, news: and
+// xhtml:link) are matched by their local name, so sitemaps that forget to declare the namespaces still parse.
 type UrlEntry struct {
-	Loc string `xml:"loc"`
+	Loc        string             `xml:"loc" json:"loc"`
+	LastMod    string             `xml:"lastmod" json:"lastmod,omitempty"`       // W3C Datetime, see LastModified
+	ChangeFreq string             `xml:"changefreq" json:"changefreq,omitempty"` // always, hourly, daily, weekly, monthly, yearly or never
+	Priority   *float64           `xml:"priority" json:"priority,omitempty"`
+	Images     []SitemapImage     `xml:"image" json:"images,omitempty"`
+	Videos     []SitemapVideo     `xml:"video" json:"videos,omitempty"`
+	News       *SitemapNews       `xml:"news" json:"news,omitempty"`
+	Alternates []SitemapAlternate `xml:"link" json:"alternates,omitempty"` // xhtml:link alternate language versions
+}
+
+// UnmarshalXML decodes a <url> element. A malformed <priority> is ignored rather than failing the whole sitemap.
+func (e *UrlEntry) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	type plainEntry UrlEntry
+	var raw struct {
+		plainEntry
+		Priority string `xml:"priority"`
+	}
+	if err := d.DecodeElement(&raw, &start); err != nil {
+		return err
+	}
+	*e = UrlEntry(raw.plainEntry)
+	e.Priority = parsePriority(raw.Priority)
+	return nil
+}
+
+// parsePriority parses a <priority>, returning nil if it is missing or isn't a number.
+func parsePriority(value string) *float64 {
+	priority, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || math.IsNaN(priority) || math.IsInf(priority, 0) {
+		return nil
+	}
+	return &priority
+}
+
+// withoutExtensions returns the entry with only its core metadata: loc, lastmod, changefreq and priority.
+func (e UrlEntry) withoutExtensions() UrlEntry {
+	return UrlEntry{Loc: e.Loc, LastMod: e.LastMod, ChangeFreq: e.ChangeFreq, Priority: e.Priority}
+}
+
+// LastModified parses LastMod, which may be a date or a date and time in any of the W3C Datetime formats.
+func (e UrlEntry) LastModified() (time.Time, bool) {
+	return parseW3CDatetime(e.LastMod)
+}
+
+// SitemapImage is an <image:image> in a sitemap entry.
+type SitemapImage struct {
+	Loc     string `xml:"loc" json:"loc"`
+	Title   string `xml:"title" json:"title,omitempty"`
+	Caption string `xml:"caption" json:"caption,omitempty"`
+}
+
+// SitemapVideo is a <video:video> in a sitemap entry.
+type SitemapVideo struct {
+	ThumbnailLoc    string `xml:"thumbnail_loc" json:"thumbnailLoc,omitempty"`
+	Title           string `xml:"title" json:"title,omitempty"`
+	Description     string `xml:"description" json:"description,omitempty"`
+	ContentLoc      string `xml:"content_loc" json:"contentLoc,omitempty"`
+	PlayerLoc       string `xml:"player_loc" json:"playerLoc,omitempty"`
+	Duration        int    `xml:"duration" json:"duration,omitempty"` // Seconds
+	PublicationDate string `xml:"publication_date" json:"publicationDate,omitempty"`
+}
+
+// UnmarshalXML decodes a <video:video> element. A malformed <video:duration> is ignored rather than failing the whole
+// sitemap, and fractional seconds are rounded.
+func (v *SitemapVideo) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	type plainVideo SitemapVideo
+	var raw struct {
+		plainVideo
+		Duration string `xml:"duration"`
+	}
+	if err := d.DecodeElement(&raw, &start); err != nil {
+		return err
+	}
+	*v = SitemapVideo(raw.plainVideo)
+	if duration, err := strconv.ParseFloat(strings.TrimSpace(raw.Duration), 64); err == nil && duration >= 0 && duration <= math.MaxInt32 {
+		v.Duration = int(math.Round(duration))
+	}
+	return nil
+}
+
+// SitemapNews is a <news:news> in a sitemap entry.
+type SitemapNews struct {
+	PublicationName     string `xml:"publication>name" json:"publicationName,omitempty"`
+	PublicationLanguage string `xml:"publication>language" json:"publicationLanguage,omitempty"`
+	PublicationDate     string `xml:"publication_date" json:"publicationDate,omitempty"`
+	Title               string `xml:"title" json:"title,omitempty"`
+	Keywords            string `xml:"keywords" json:"keywords,omitempty"`
+}
+
+// SitemapAlternate is an <xhtml:link rel="alternate" hreflang="..." href="..."> in a sitemap entry.
+type SitemapAlternate struct {
+	Rel      string `xml:"rel,attr" json:"rel,omitempty"`
+	Hreflang string `xml:"hreflang,attr" json:"hreflang,omitempty"`
+	Href     string `xml:"href,attr" json:"href"`
+}
+
+// w3cDatetimeLayouts are the W3C Datetime formats allowed for <lastmod>, most precise first.
+var w3cDatetimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02",
+	"2006-01",
+	"2006",
+}
+
+// parseW3CDatetime parses a date in any of the W3C Datetime formats.
+func parseW3CDatetime(value string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	for _, layout := range w3cDatetimeLayouts {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			return parsed, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// SitemapEntry is a child sitemap listed in a <sitemapindex>.
+type SitemapEntry struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod"`
+}
+
+// LastModified parses LastMod, which may be a date or a date and time in any of the W3C Datetime formats.
+func (e SitemapEntry) LastModified() (time.Time, bool) {
+	return parseW3CDatetime(e.LastMod)
+}
+
+// Sitemap is a parsed sitemap file: a <urlset> lists page URLs, while a <sitemapindex> lists other sitemaps.
+type Sitemap struct {
+	URLs     []UrlEntry     `xml:"url"`
+	Sitemaps []SitemapEntry `xml:"sitemap"`
+}
+
+// IsIndex reports whether the sitemap is a sitemap index.
+func (s *Sitemap) IsIndex() bool {
+	return len(s.Sitemaps) > 0
+}
+
+// ParseSitemap parses a sitemap or sitemap index, keeping only the entries with a <loc>. Like ParseSitemapReader it
+// accepts gzip compressed and plain text sitemaps as well as XML.
+func ParseSitemap(sitemap string) (*Sitemap, error) {
+	return ParseSitemapReader(strings.NewReader(sitemap), 0)
+}
+
+// ParseSitemapReader parses a sitemap as it is read, working out its format from its content: gzip compressed data is
+// decompressed first, content starting with "<" is parsed as an XML sitemap or sitemap index, and anything else as a
+// plain text sitemap with one URL per line. If maxBytes is above zero, reading more than maxBytes of sitemap, either
+// from r or after decompressing it, fails with ErrSitemapTooLarge, so a small compressed file can't expand without
+// bound. The limit applies to r too because r may already be decompressing, e.g. an HTTP body with Content-Encoding.
+func ParseSitemapReader(r io.Reader, maxBytes int64) (*Sitemap, error) {
+	if maxBytes > 0 {
+		r = &sizeLimitedReader{r: r, remaining: maxBytes}
+	}
+	buffered := bufio.NewReader(r)
+	if magic, _ := buffered.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		decompressed, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, err
+		}
+		defer decompressed.Close()
+		buffered = bufio.NewReader(decompressed)
+	}
+	if maxBytes > 0 {
+		buffered = bufio.NewReader(&sizeLimitedReader{r: buffered, remaining: maxBytes})
+	}
+
+	if isXMLSitemap(buffered) {
+		return parseXMLSitemap(buffered)
+	}
+	return parseTextSitemap(buffered)
+}
+
+// isXMLSitemap reports whether the content starts with "<", after any byte order mark and leading whitespace.
+func isXMLSitemap(r *bufio.Reader) bool {
+	for {
+		c, _, err := r.ReadRune()
+		if err != nil {
+			return false
+		}
+		if c == '\uFEFF' || c == ' ' || c == '\t' || c == '\r' || c == '\n' {
+			continue
+		}
+		_ = r.UnreadRune()
+		return c == '<'
+	}
+}
+
+// parseXMLSitemap streams the <url> and <sitemap> elements out of an XML sitemap or sitemap index.
+func parseXMLSitemap(r io.Reader) (*Sitemap, error) {
+	var parsed Sitemap
+	decoder := xml.NewDecoder(r)
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "url":
+			var entry UrlEntry
+			if err := decoder.DecodeElement(&entry, &start); err != nil {
+				return nil, err
+			}
+			if entry.Loc != "" {
+				parsed.URLs = append(parsed.URLs, entry)
+			}
+		case "sitemap":
+			var entry SitemapEntry
+			if err := decoder.DecodeElement(&entry, &start); err != nil {
+				return nil, err
+			}
+			if entry.Loc != "" {
+				parsed.Sitemaps = append(parsed.Sitemaps, entry)
+			}
+		}
+	}
+	return &parsed, nil
+}
+
+// parseTextSitemap reads a plain text sitemap, which lists one absolute URL per line. Lines that aren't absolute
+// http(s) URLs are skipped.
+func parseTextSitemap(r io.Reader) (*Sitemap, error) {
+	var parsed Sitemap
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		parsedURL, err := url.Parse(line)
+		if err != nil || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") || parsedURL.Host == "" {
+			continue
+		}
+		parsed.URLs = append(parsed.URLs, UrlEntry{Loc: line})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return &parsed, nil
+}
+
+// sizeLimitedReader reads from r until remaining bytes have been read, then fails with ErrSitemapTooLarge if there is
+// any more to read.
+type sizeLimitedReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (l *sizeLimitedReader) Read(p []byte) (int, error) {
+	if l.remaining <= 0 {
+		// Only an error if the content really does carry on past the limit
+		if n, err := l.r.Read(make([]byte, 1)); n == 0 && err != nil {
+			return 0, err
+		}
+		return 0, ErrSitemapTooLarge
+	}
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	return n, err
+}
+
+// ParseSitemapEntries takes a sitemap string and extracts all entries with a <loc> from it.
+func ParseSitemapEntries(sitemap string) ([]UrlEntry, error) {
+	parsed, err := ParseSitemap(sitemap)
+	if err != nil {
+		return nil, err
+	}
+	return parsed.URLs, nil
 }
 
 // ParseSitemapForUrls takes a sitemap string and extracts all URLs from it.
 func ParseSitemapForUrls(sitemap string) ([]string, error) {
-	var urlSet UrlSet
-	err := xml.Unmarshal([]byte(sitemap), &urlSet)
+	entries, err := ParseSitemapEntries(sitemap)
 	if err != nil {
 		return nil, err
 	}
 
-	return lo.Reduce(urlSet.URLs, func(acc []string, entry UrlEntry, _ int) []string {
-		if entry.Loc != "" {
-			return append(acc, entry.Loc)
-		}
-		return acc
-	}, []string{}), nil
+	return lo.Map(entries, func(entry UrlEntry, _ int) string {
+		return entry.Loc
+	}), nil
 }
@@ -1,9 +1,13 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestParseSitemapForUrls_ReturnsErrorOnInvalidXML(t *testing.T) {
@@ -56,3 +60,225 @@ func TestParseSitemapForUrls_NoLocTags(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, 0, len(urls))
 }
+
+func TestParseSitemapEntries_ReadsPriority(t *testing.T) {
+	t.Parallel()
+	sitemap := `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+	<url>
+		<loc>http://example.com</loc>
+		<priority>1.0</priority>
+	</url>
+	<url>
+		<loc>http://example.com/about</loc>
+		<priority> 0.3 </priority>
+	</url>
+	<url>
+		<loc>http://example.com/contact</loc>
+	</url>
+	<url>
+		<priority>0.5</priority>
+	</url>
+	</urlset>`
+	entries, err := ParseSitemapEntries(sitemap)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	require.NotNil(t, entries[0].Priority)
+	assert.Equal(t, 1.0, *entries[0].Priority)
+	require.NotNil(t, entries[1].Priority)
+	assert.Equal(t, 0.3, *entries[1].Priority)
+	assert.Nil(t, entries[2].Priority)
+}
+
+func TestParseSitemapEntries_IgnoresMalformedPriority(t *testing.T) {
+	t.Parallel()
+	sitemap := `<urlset>
+	<url><loc>http://example.com</loc><priority>high</priority></url>
+	<url><loc>http://example.com/about</loc><priority>0.4</priority></url>
+	</urlset>`
+	entries, err := ParseSitemapEntries(sitemap)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "http://example.com", entries[0].Loc)
+	assert.Nil(t, entries[0].Priority)
+	require.NotNil(t, entries[1].Priority)
+	assert.Equal(t, 0.4, *entries[1].Priority)
+}
+
+func TestParseSitemap_ReadsSitemapIndex(t *testing.T) {
+	t.Parallel()
+	sitemap := `<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+	<sitemap><loc>https://example.com/sitemap-news.xml</loc><lastmod>2024-01-01</lastmod></sitemap>
+	<sitemap><loc>https://example.com/sitemap-pages.xml</loc></sitemap>
+	<sitemap><lastmod>2024-01-01</lastmod></sitemap>
+	</sitemapindex>`
+	parsed, err := ParseSitemap(sitemap)
+	require.NoError(t, err)
+	assert.True(t, parsed.IsIndex())
+	assert.Empty(t, parsed.URLs)
+	assert.Equal(t, []SitemapEntry{
+		{Loc: "https://example.com/sitemap-news.xml", LastMod: "2024-01-01"},
+		{Loc: "https://example.com/sitemap-pages.xml"},
+	}, parsed.Sitemaps)
+}
+
+func TestParseSitemap_UrlSetIsNotAnIndex(t *testing.T) {
+	t.Parallel()
+	parsed, err := ParseSitemap(`<urlset><url><loc>https://example.com/</loc></url></urlset>`)
+	require.NoError(t, err)
+	assert.False(t, parsed.IsIndex())
+	assert.Len(t, parsed.URLs, 1)
+}
+
+func gzipString(t *testing.T, s string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	_, err := writer.Write([]byte(s))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	return buf.String()
+}
+
+func TestParseSitemap_DecompressesGzip(t *testing.T) {
+	t.Parallel()
+	parsed, err := ParseSitemap(gzipString(t, `<urlset><url><loc>https://example.com/a</loc></url><url><loc>https://example.com/b</loc></url></urlset>`))
+	require.NoError(t, err)
+	assert.Equal(t, []UrlEntry{{Loc: "https://example.com/a"}, {Loc: "https://example.com/b"}}, parsed.URLs)
+}
+
+func TestParseSitemap_ReadsPlainText(t *testing.T) {
+	t.Parallel()
+	sitemap := "https://example.com/a\r\n\n  https://example.com/b  \nnot a url\n/relative\nftp://example.com/file\n"
+	parsed, err := ParseSitemap(sitemap)
+	require.NoError(t, err)
+	assert.Equal(t, []UrlEntry{{Loc: "https://example.com/a"}, {Loc: "https://example.com/b"}}, parsed.URLs)
+
+	parsed, err = ParseSitemap(gzipString(t, sitemap))
+	require.NoError(t, err)
+	assert.Len(t, parsed.URLs, 2)
+}
+
+func TestParseSitemap_SniffsXMLAfterBOMAndWhitespace(t *testing.T) {
+	t.Parallel()
+	parsed, err := ParseSitemap("\uFEFF\n  <?xml version=\"1.0\"?><urlset><url><loc>https://example.com/</loc></url></urlset>")
+	require.NoError(t, err)
+	assert.Len(t, parsed.URLs, 1)
+}
+
+func TestParseSitemapReader_CapsDecompressedSize(t *testing.T) {
+	t.Parallel()
+	// Compresses to a few kilobytes
+	bomb := gzipString(t, "<urlset>"+strings.Repeat("<url><loc>https://example.com/</loc></url>", 100_000)+"</urlset>")
+	require.Less(t, len(bomb), 100_000)
+
+	_, err := ParseSitemapReader(strings.NewReader(bomb), 1024*1024)
+	assert.ErrorIs(t, err, ErrSitemapTooLarge)
+
+	parsed, err := ParseSitemapReader(strings.NewReader(bomb), 10*1024*1024)
+	require.NoError(t, err)
+	assert.Len(t, parsed.URLs, 100_000)
+}
+
+func TestParseSitemapReader_AllowsSitemapExactlyAtLimit(t *testing.T) {
+	t.Parallel()
+	sitemap := "https://example.com/a\n"
+	parsed, err := ParseSitemapReader(strings.NewReader(sitemap), int64(len(sitemap)))
+	require.NoError(t, err)
+	assert.Len(t, parsed.URLs, 1)
+}
+
+func TestParseSitemap_ReadsEntryMetadataAndExtensions(t *testing.T) {
+	t.Parallel()
+	sitemap := `<?xml version="1.0" encoding="UTF-8"?>
+	<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9"
+		xmlns:image="http://www.google.com/schemas/sitemap-image/1.1"
+		xmlns:video="http://www.google.com/schemas/sitemap-video/1.1"
+		xmlns:news="http://www.google.com/schemas/sitemap-news/0.9"
+		xmlns:xhtml="http://www.w3.org/1999/xhtml">
+	<url>
+		<loc>https://example.com/story</loc>
+		<lastmod>2024-03-01T10:30:00+00:00</lastmod>
+		<changefreq>daily</changefreq>
+		<priority>0.8</priority>
+		<xhtml:link rel="alternate" hreflang="de" href="https://example.com/de/story"/>
+		<image:image><image:loc>https://example.com/story.jpg</image:loc><image:caption>A picture</image:caption></image:image>
+		<image:image><image:loc>https://example.com/story-2.jpg</image:loc></image:image>
+		<video:video>
+			<video:thumbnail_loc>https://example.com/thumb.jpg</video:thumbnail_loc>
+			<video:title>The video</video:title>
+			<video:content_loc>https://example.com/video.mp4</video:content_loc>
+			<video:duration>600</video:duration>
+		</video:video>
+		<news:news>
+			<news:publication><news:name>Example Times</news:name><news:language>en</news:language></news:publication>
+			<news:publication_date>2024-03-01</news:publication_date>
+			<news:title>Something happened</news:title>
+		</news:news>
+	</url>
+	</urlset>`
+	parsed, err := ParseSitemap(sitemap)
+	require.NoError(t, err)
+	require.Len(t, parsed.URLs, 1)
+	entry := parsed.URLs[0]
+	assert.Equal(t, "2024-03-01T10:30:00+00:00", entry.LastMod)
+	assert.Equal(t, "daily", entry.ChangeFreq)
+	require.NotNil(t, entry.Priority)
+	assert.Equal(t, 0.8, *entry.Priority)
+	assert.Equal(t, []SitemapAlternate{{Rel: "alternate", Hreflang: "de", Href: "https://example.com/de/story"}}, entry.Alternates)
+	assert.Equal(t, []SitemapImage{{Loc: "https://example.com/story.jpg", Caption: "A picture"}, {Loc: "https://example.com/story-2.jpg"}}, entry.Images)
+	assert.Equal(t, []SitemapVideo{{
+		ThumbnailLoc: "https://example.com/thumb.jpg",
+		Title:        "The video",
+		ContentLoc:   "https://example.com/video.mp4",
+		Duration:     600,
+	}}, entry.Videos)
+	assert.Equal(t, &SitemapNews{
+		PublicationName:     "Example Times",
+		PublicationLanguage: "en",
+		PublicationDate:     "2024-03-01",
+		Title:               "Something happened",
+	}, entry.News)
+}
+
+func TestParseSitemap_IgnoresMalformedExtensionMetadata(t *testing.T) {
+	t.Parallel()
+	sitemap := `<urlset>
+	<url>
+		<loc>https://example.com/a</loc>
+		<video:video><video:title>Half</video:title><video:duration>12.5</video:duration></video:video>
+	</url>
+	<url>
+		<loc>https://example.com/b</loc>
+		<video:video><video:title>Long</video:title><video:duration>ten minutes</video:duration></video:video>
+	</url>
+	<url><loc>https://example.com/c</loc></url>
+	</urlset>`
+	parsed, err := ParseSitemap(sitemap)
+	require.NoError(t, err)
+	require.Len(t, parsed.URLs, 3)
+	assert.Equal(t, []SitemapVideo{{Title: "Half", Duration: 13}}, parsed.URLs[0].Videos)
+	assert.Equal(t, []SitemapVideo{{Title: "Long"}}, parsed.URLs[1].Videos)
+}
+
+func TestUrlEntry_LastModified(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		lastMod string
+		want    time.Time
+		ok      bool
+	}{
+		{lastMod: "2024-03-01T10:30:15.5+01:00", want: time.Date(2024, 3, 1, 9, 30, 15, 500_000_000, time.UTC), ok: true},
+		{lastMod: "2024-03-01T10:30:15Z", want: time.Date(2024, 3, 1, 10, 30, 15, 0, time.UTC), ok: true},
+		{lastMod: "2024-03-01T10:30+00:00", want: time.Date(2024, 3, 1, 10, 30, 0, 0, time.UTC), ok: true},
+		{lastMod: " 2024-03-01 ", want: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), ok: true},
+		{lastMod: "2024-03", want: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), ok: true},
+		{lastMod: "2024", want: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), ok: true},
+		{lastMod: "", ok: false},
+		{lastMod: "yesterday", ok: false},
+	}
+	for _, tt := range tests {
+		got, ok := UrlEntry{LastMod: tt.lastMod}.LastModified()
+		assert.Equal(t, tt.ok, ok, tt.lastMod)
+		assert.True(t, tt.want.Equal(got), "%s parsed as %s", tt.lastMod, got)
+	}
+}
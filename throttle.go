@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Throttle provides per-host politeness on top of the worker pool. It pauses a host after it signals overload
+// (429/503, usually with a Retry-After header) and adapts the number of concurrent requests allowed to each host:
+// halving it when the host pushes back and adding one again for every window of successful responses.
+type Throttle struct {
+	MaxConcurrency int           // Upper bound for concurrent requests per host
+	MaxPause       time.Duration // Cap on how long a single Retry-After can pause a host or delay a retry
+	Cooldown       time.Duration // Minimum time between two concurrency reductions for the same host
+
+	mu      sync.Mutex
+	hosts   map[string]*hostThrottle
+	changed chan struct{}
+}
+
+type hostThrottle struct {
+	pausedUntil  time.Time
+	limit        int
+	inFlight     int
+	successes    int
+	lastDecrease time.Time
+}
+
+// NewThrottle creates a Throttle allowing up to maxConcurrency concurrent requests per host.
+func NewThrottle(maxConcurrency int) *Throttle {
+	return &Throttle{
+		MaxConcurrency: max(maxConcurrency, 1),
+		MaxPause:       5 * time.Minute,
+		Cooldown:       time.Second,
+		hosts:          make(map[string]*hostThrottle),
+		changed:        make(chan struct{}),
+	}
+}
+
+// Acquire blocks until the host is not paused and has a free concurrency slot, or until ctx is done.
+// Every successful Acquire must be paired with a call to Release.
+func (t *Throttle) Acquire(ctx context.Context, host string) error {
+	for {
+		t.mu.Lock()
+		h := t.host(host)
+		changed := t.changed
+		wait := time.Until(h.pausedUntil)
+		if wait <= 0 && h.inFlight < h.limit {
+			h.inFlight++
+			t.mu.Unlock()
+			return nil
+		}
+		t.mu.Unlock()
+
+		var timer <-chan time.Time
+		if wait > 0 {
+			timer = time.After(wait)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		case <-timer:
+		}
+	}
+}
+
+// Release frees the slot taken by Acquire.
+func (t *Throttle) Release(host string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.host(host).inFlight--
+	t.notify()
+}
+
+// Succeeded records a healthy response from host, slowly ramping its concurrency back up.
+func (t *Throttle) Succeeded(host string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	h := t.host(host)
+	if h.limit >= t.MaxConcurrency {
+		return
+	}
+	h.successes++
+	if h.successes >= h.limit {
+		h.limit++
+		h.successes = 0
+		t.notify()
+	}
+}
+
+// Throttled records that host asked us to back off, pausing it for the given duration and halving its concurrency.
+func (t *Throttle) Throttled(host string, pause time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	h := t.host(host)
+	now := time.Now()
+	pause = t.capPause(pause)
+	if until := now.Add(pause); until.After(h.pausedUntil) {
+		h.pausedUntil = until
+	}
+	h.successes = 0
+	if now.Sub(h.lastDecrease) >= t.Cooldown {
+		h.limit = max(h.limit/2, 1)
+		h.lastDecrease = now
+	}
+}
+
+// capPause limits pause to MaxPause, if it is set.
+func (t *Throttle) capPause(pause time.Duration) time.Duration {
+	if t.MaxPause > 0 && pause > t.MaxPause {
+		return t.MaxPause
+	}
+	return pause
+}
+
+// Concurrency returns the number of concurrent requests currently allowed for host.
+func (t *Throttle) Concurrency(host string) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.host(host).limit
+}
+
+// host returns the state for host, creating it if needed. The caller must hold t.mu.
+func (t *Throttle) host(host string) *hostThrottle {
+	h, ok := t.hosts[host]
+	if !ok {
+		h = &hostThrottle{limit: t.MaxConcurrency}
+		t.hosts[host] = h
+	}
+	return h
+}
+
+// notify wakes up everything blocked in Acquire. The caller must hold t.mu.
+func (t *Throttle) notify() {
+	close(t.changed)
+	t.changed = make(chan struct{})
+}
+
+// isThrottlingError reports whether err is a response telling us to slow down.
+func isThrottlingError(err error) bool {
+	var httpErr *httpError
+	if !errors.As(err, &httpErr) {
+		return false
+	}
+	return httpErr.StatusCode == http.StatusTooManyRequests || httpErr.StatusCode == http.StatusServiceUnavailable
+}
+
+// retryAfterFromError extracts the Retry-After delay from an httpError, if it has one.
+func retryAfterFromError(err error) (time.Duration, bool) {
+	var httpErr *httpError
+	if !errors.As(err, &httpErr) || httpErr.Header == nil {
+		return 0, false
+	}
+	return ParseRetryAfter(httpErr.Header.Get("Retry-After"), time.Now())
+}
+
+// ParseRetryAfter parses a Retry-After header value, which is either a number of seconds or an HTTP-date.
+// Dates in the past yield a zero delay.
+func ParseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	return max(date.Sub(now), 0), true
+}
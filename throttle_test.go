@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		value    string
+		expected time.Duration
+		ok       bool
+	}{
+		{name: "seconds", value: "120", expected: 2 * time.Minute, ok: true},
+		{name: "zero seconds", value: "0", expected: 0, ok: true},
+		{name: "http date", value: "Mon, 01 Jan 2024 12:00:30 GMT", expected: 30 * time.Second, ok: true},
+		{name: "http date in the past", value: "Mon, 01 Jan 2024 11:00:00 GMT", expected: 0, ok: true},
+		{name: "empty", value: "", expected: 0, ok: false},
+		{name: "negative", value: "-5", expected: 0, ok: false},
+		{name: "garbage", value: "soon", expected: 0, ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delay, ok := ParseRetryAfter(tt.value, now)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.expected, delay)
+		})
+	}
+}
+
+func TestRetryAfterFromError_ReadsHeaderFromHttpError(t *testing.T) {
+	t.Parallel()
+	err := &httpError{StatusCode: 429, Header: http.Header{"Retry-After": []string{"3"}}}
+	delay, ok := retryAfterFromError(err)
+	assert.True(t, ok)
+	assert.Equal(t, 3*time.Second, delay)
+	assert.True(t, isThrottlingError(err))
+
+	_, ok = retryAfterFromError(&httpError{StatusCode: 500})
+	assert.False(t, ok)
+	assert.False(t, isThrottlingError(&httpError{StatusCode: 500}))
+}
+
+func TestThrottle_HalvesConcurrencyWhenThrottledAndRampsBackUp(t *testing.T) {
+	t.Parallel()
+	throttle := NewThrottle(8)
+	throttle.Cooldown = 0
+	assert.Equal(t, 8, throttle.Concurrency("example.com"))
+
+	throttle.Throttled("example.com", 0)
+	assert.Equal(t, 4, throttle.Concurrency("example.com"))
+	throttle.Throttled("example.com", 0)
+	throttle.Throttled("example.com", 0)
+	throttle.Throttled("example.com", 0)
+	assert.Equal(t, 1, throttle.Concurrency("example.com"), "concurrency never drops below one")
+	assert.Equal(t, 8, throttle.Concurrency("other.com"), "other hosts are unaffected")
+
+	throttle.Succeeded("example.com")
+	assert.Equal(t, 2, throttle.Concurrency("example.com"))
+	throttle.Succeeded("example.com")
+	throttle.Succeeded("example.com")
+	assert.Equal(t, 3, throttle.Concurrency("example.com"))
+	for i := 0; i < 100; i++ {
+		throttle.Succeeded("example.com")
+	}
+	assert.Equal(t, 8, throttle.Concurrency("example.com"), "concurrency never exceeds the maximum")
+}
+
+func TestThrottle_CooldownLimitsReductions(t *testing.T) {
+	t.Parallel()
+	throttle := NewThrottle(8)
+	throttle.Cooldown = time.Hour
+	throttle.Throttled("example.com", 0)
+	throttle.Throttled("example.com", 0)
+	assert.Equal(t, 4, throttle.Concurrency("example.com"))
+}
+
+func TestThrottle_AcquireWaitsForPausedHost(t *testing.T) {
+	t.Parallel()
+	throttle := NewThrottle(2)
+	throttle.Throttled("example.com", 200*time.Millisecond)
+
+	start := time.Now()
+	require.NoError(t, throttle.Acquire(context.Background(), "example.com"))
+	throttle.Release("example.com")
+	assert.GreaterOrEqual(t, time.Since(start), 150*time.Millisecond)
+
+	start = time.Now()
+	require.NoError(t, throttle.Acquire(context.Background(), "other.com"))
+	throttle.Release("other.com")
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+}
+
+func TestThrottle_AcquireBlocksAtConcurrencyLimit(t *testing.T) {
+	t.Parallel()
+	throttle := NewThrottle(1)
+	require.NoError(t, throttle.Acquire(context.Background(), "example.com"))
+
+	acquired := make(chan struct{})
+	go func() {
+		_ = throttle.Acquire(context.Background(), "example.com")
+		close(acquired)
+	}()
+
+	require.Never(t, func() bool {
+		select {
+		case <-acquired:
+			return true
+		default:
+			return false
+		}
+	}, 100*time.Millisecond, 10*time.Millisecond)
+
+	throttle.Release("example.com")
+	require.Eventually(t, func() bool {
+		select {
+		case <-acquired:
+			return true
+		default:
+			return false
+		}
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestThrottle_AcquireRespectsContextCancellation(t *testing.T) {
+	t.Parallel()
+	throttle := NewThrottle(1)
+	throttle.Throttled("example.com", time.Minute)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := throttle.Acquire(ctx, "example.com")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"maps"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// DefaultDeniedExtensions are file extensions that are almost never HTML pages, for use with ExtensionRule.
+var DefaultDeniedExtensions = []string{
+	".pdf", ".zip", ".gz", ".tar", ".rar", ".7z", ".exe", ".dmg", ".iso",
+	".jpg", ".jpeg", ".png", ".gif", ".webp", ".svg", ".ico",
+	".mp3", ".mp4", ".avi", ".mov", ".webm",
+	".doc", ".docx", ".xls", ".xlsx", ".ppt", ".pptx",
+	".css", ".js", ".json", ".xml",
+}
+
+// URLRule matches URLs for a URLFilter. Its Name identifies it in the filter's rejection counts.
+type URLRule struct {
+	Name  string
+	Match func(u *url.URL) bool
+}
+
+// RegexRule matches URLs whose full string form matches a regular expression.
+func RegexRule(pattern string) (URLRule, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return URLRule{}, err
+	}
+	return URLRule{
+		Name:  "regex:" + pattern,
+		Match: func(u *url.URL) bool { return re.MatchString(u.String()) },
+	}, nil
+}
+
+// GlobRule matches URLs whose path matches a glob pattern, using path.Match syntax: * matches within a single path
+// segment, so "/blog/*/comments" matches "/blog/post-1/comments" but not "/blog/2024/post-1/comments".
+func GlobRule(pattern string) (URLRule, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return URLRule{}, err
+	}
+	return URLRule{
+		Name: "glob:" + pattern,
+		Match: func(u *url.URL) bool {
+			matched, _ := path.Match(pattern, u.Path)
+			return matched
+		},
+	}, nil
+}
+
+// PathPrefixRule matches URLs whose path starts with prefix.
+func PathPrefixRule(prefix string) URLRule {
+	return URLRule{
+		Name:  "prefix:" + prefix,
+		Match: func(u *url.URL) bool { return strings.HasPrefix(u.Path, prefix) },
+	}
+}
+
+// QueryParamRule matches URLs that have any of the given query parameters, whatever their value.
+func QueryParamRule(names ...string) URLRule {
+	return URLRule{
+		Name: "query:" + strings.Join(names, ","),
+		Match: func(u *url.URL) bool {
+			query := u.Query()
+			for _, name := range names {
+				if query.Has(name) {
+					return true
+				}
+			}
+			return false
+		},
+	}
+}
+
+// ExtensionRule matches URLs whose path ends in any of the given file extensions (with the leading dot), ignoring case.
+func ExtensionRule(extensions ...string) URLRule {
+	lowered := make(map[string]struct{}, len(extensions))
+	for _, extension := range extensions {
+		lowered[strings.ToLower(extension)] = struct{}{}
+	}
+	return URLRule{
+		Name: "extension:" + strings.Join(extensions, ","),
+		Match: func(u *url.URL) bool {
+			_, ok := lowered[strings.ToLower(path.Ext(u.Path))]
+			return ok
+		},
+	}
+}
+
+// noAllowRuleMatched is the rejection count key for URLs that matched none of a filter's Allow rules.
+const noAllowRuleMatched = "allow:none"
+
+// URLFilter decides which discovered URLs may be enqueued. A URL is rejected if it matches any Deny rule, or if there
+// are Allow rules and it matches none of them. The filter counts how many URLs each rule rejected.
+type URLFilter struct {
+	Allow []URLRule
+	Deny  []URLRule
+
+	mu         sync.Mutex
+	rejections map[string]int64
+}
+
+// Allowed reports whether a URL passes the filter, and if not the name of the rule that rejected it. A nil filter
+// allows everything.
+func (f *URLFilter) Allowed(u *url.URL) (bool, string) {
+	if f == nil {
+		return true, ""
+	}
+	for _, rule := range f.Deny {
+		if rule.Match(u) {
+			f.reject(rule.Name)
+			return false, rule.Name
+		}
+	}
+	if len(f.Allow) == 0 {
+		return true, ""
+	}
+	for _, rule := range f.Allow {
+		if rule.Match(u) {
+			return true, ""
+		}
+	}
+	f.reject(noAllowRuleMatched)
+	return false, noAllowRuleMatched
+}
+
+// Rejections returns how many URLs each rule has rejected, keyed by rule name. URLs that matched no Allow rule are
+// counted under "allow:none".
+func (f *URLFilter) Rejections() map[string]int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return maps.Clone(f.rejections)
+}
+
+// reject counts a URL rejected by the named rule.
+func (f *URLFilter) reject(name string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.rejections == nil {
+		f.rejections = make(map[string]int64)
+	}
+	f.rejections[name]++
+}
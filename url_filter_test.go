@@ -0,0 +1,88 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/url"
+	"testing"
+)
+
+func mustParse(t *testing.T, rawURL string) *url.URL {
+	t.Helper()
+	parsed, err := url.Parse(rawURL)
+	require.NoError(t, err)
+	return parsed
+}
+
+func TestURLRules_Match(t *testing.T) {
+	regex, err := RegexRule(`/\d{4}/\d{2}/`)
+	require.NoError(t, err)
+	glob, err := GlobRule("/blog/*/comments")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		rule     URLRule
+		url      string
+		expected bool
+	}{
+		{name: "regex match", rule: regex, url: "https://example.com/news/2024/05/story", expected: true},
+		{name: "regex no match", rule: regex, url: "https://example.com/news/story", expected: false},
+		{name: "glob match", rule: glob, url: "https://example.com/blog/post-1/comments", expected: true},
+		{name: "glob doesn't cross segments", rule: glob, url: "https://example.com/blog/2024/post-1/comments", expected: false},
+		{name: "prefix match", rule: PathPrefixRule("/news/"), url: "https://example.com/news/story", expected: true},
+		{name: "prefix no match", rule: PathPrefixRule("/news/"), url: "https://example.com/newsletter", expected: false},
+		{name: "query param present", rule: QueryParamRule("sessionid", "sort"), url: "https://example.com/?sort=", expected: true},
+		{name: "query param absent", rule: QueryParamRule("sessionid"), url: "https://example.com/?session=1", expected: false},
+		{name: "extension match ignores case", rule: ExtensionRule(".pdf", ".zip"), url: "https://example.com/report.PDF", expected: true},
+		{name: "extension ignores query", rule: ExtensionRule(".pdf"), url: "https://example.com/view?file=report.pdf", expected: false},
+		{name: "default extensions", rule: ExtensionRule(DefaultDeniedExtensions...), url: "https://example.com/photo.jpg", expected: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.rule.Match(mustParse(t, tt.url)))
+		})
+	}
+}
+
+func TestURLRules_RejectInvalidPatterns(t *testing.T) {
+	_, err := RegexRule("(")
+	assert.Error(t, err)
+	_, err = GlobRule("[")
+	assert.Error(t, err)
+}
+
+func TestURLFilter_AllowedAndCountsRejections(t *testing.T) {
+	filter := &URLFilter{
+		Allow: []URLRule{PathPrefixRule("/docs/"), PathPrefixRule("/blog/")},
+		Deny:  []URLRule{ExtensionRule(".pdf"), QueryParamRule("print")},
+	}
+
+	allowed, rule := filter.Allowed(mustParse(t, "https://example.com/docs/intro"))
+	assert.True(t, allowed)
+	assert.Empty(t, rule)
+
+	allowed, rule = filter.Allowed(mustParse(t, "https://example.com/docs/manual.pdf"))
+	assert.False(t, allowed, "deny rules win over allow rules")
+	assert.Equal(t, "extension:.pdf", rule)
+
+	allowed, _ = filter.Allowed(mustParse(t, "https://example.com/blog/post?print=1"))
+	assert.False(t, allowed)
+	allowed, _ = filter.Allowed(mustParse(t, "https://example.com/blog/other.pdf"))
+	assert.False(t, allowed)
+	allowed, rule = filter.Allowed(mustParse(t, "https://example.com/shop"))
+	assert.False(t, allowed)
+	assert.Equal(t, "allow:none", rule)
+
+	assert.Equal(t, map[string]int64{
+		"extension:.pdf": 2,
+		"query:print":    1,
+		"allow:none":     1,
+	}, filter.Rejections())
+}
+
+func TestURLFilter_NilAllowsEverything(t *testing.T) {
+	var filter *URLFilter
+	allowed, _ := filter.Allowed(mustParse(t, "https://example.com/anything.pdf"))
+	assert.True(t, allowed)
+}
@@ -9,7 +9,7 @@ import (
 // ResolveAndCleanURL resolves href against base and sanitizes it:
 // - Makes it absolute
 // - Strips fragments (#...)
-// - Normalizes path (removes duplicate slashes)
+// - Normalizes path (removes duplicate slashes and dot segments, keeping a trailing slash)
 func ResolveAndCleanURL(base *url.URL, href string) (*url.URL, error) {
 	parsedHref, err := url.Parse(href)
 	if err != nil {
@@ -33,8 +33,14 @@ func ResolveAndCleanURL(base *url.URL, href string) (*url.URL, error) {
 	return resolved, nil
 }
 
-// cleanPath collapses repeated slashes and uses path.Clean for dot segments
+// cleanPath collapses repeated slashes and uses path.Clean for dot segments, keeping any trailing slash
 func cleanPath(p string) string {
-	collapsed := strings.ReplaceAll(p, "//", "/")
-	return path.Clean(collapsed)
+	if p == "" {
+		return ""
+	}
+	cleaned := path.Clean(p)
+	if cleaned != "/" && (strings.HasSuffix(p, "/") || strings.HasSuffix(p, "/.") || strings.HasSuffix(p, "/..")) {
+		cleaned += "/"
+	}
+	return cleaned
 }
@@ -37,18 +37,33 @@ func TestResolveAndCleanURL(t *testing.T) {
 		{
 			name:     "just fragment",
 			href:     "#frag",
-			expected: "https://example.com/base/path",
+			expected: "https://example.com/base/path/",
 		},
 		{
 			name:     "query without path",
 			href:     "?a=1&b=2",
-			expected: "https://example.com/base/path?a=1&b=2",
+			expected: "https://example.com/base/path/?a=1&b=2",
 		},
 		{
 			name:     "path with double slashes",
 			href:     "foo////bar",
 			expected: "https://example.com/base/path/foo/bar",
 		},
+		{
+			name:     "trailing slash kept",
+			href:     "/docs//guide/",
+			expected: "https://example.com/docs/guide/",
+		},
+		{
+			name:     "trailing dot segment",
+			href:     "/docs/guide/..",
+			expected: "https://example.com/docs/",
+		},
+		{
+			name:     "host without path",
+			href:     "https://other.com",
+			expected: "https://other.com",
+		},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
+
+// PageChange describes how a page differs from the last time it was crawled.
+type PageChange string
+
+const (
+	PageNew       PageChange = "new"       // The page has no stored validators, it hasn't been crawled before
+	PageChanged   PageChange = "changed"   // The page has been crawled before and its content has changed since
+	PageUnchanged PageChange = "unchanged" // The server answered 304 Not Modified, or the content hash matched
+)
+
+// Validators is what we remember about a page between crawls, so the next crawl can fetch it conditionally.
+type Validators struct {
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"lastModified,omitempty"`
+	ContentHash  string    `json:"contentHash,omitempty"`
+	Links        []string  `json:"links,omitempty"`     // Resolved links found on the page, followed again when it is unchanged
+	Canonical    string    `json:"canonical,omitempty"` // The page's rel=canonical URL, if it declared one
+	FetchedAt    time.Time `json:"fetchedAt"`
+}
+
+// conditional reports whether there is anything to send in If-None-Match or If-Modified-Since.
+func (v Validators) conditional() bool {
+	return v.ETag != "" || v.LastModified != ""
+}
+
+// ValidatorsFromResult builds the validators for a freshly fetched page.
+func ValidatorsFromResult(result *FetchResult, links []string) Validators {
+	return Validators{
+		ETag:         result.Header.Get("ETag"),
+		LastModified: result.Header.Get("Last-Modified"),
+		ContentHash:  ContentHash(result.Body),
+		Links:        links,
+		FetchedAt:    time.Now(),
+	}
+}
+
+// ContentHash returns a hex encoded SHA-256 of a page body, used to spot unchanged pages on servers that don't
+// support conditional requests.
+func ContentHash(body string) string {
+	sum := sha256.Sum256([]byte(body))
+	return hex.EncodeToString(sum[:])
+}
+
+// ValidatorStore persists Validators per URL between crawls.
+type ValidatorStore interface {
+	// Get returns the validators stored for a URL, if any.
+	Get(url string) (Validators, bool)
+	// Put stores the validators for a URL.
+	Put(url string, validators Validators)
+	// Save persists the store.
+	Save() error
+}
+
+// FileValidatorStore is a ValidatorStore held in memory and saved to a single JSON file.
+type FileValidatorStore struct {
+	path       string
+	mu         sync.RWMutex
+	validators map[string]Validators
+}
+
+// NewFileValidatorStore loads the validators saved at path. A missing file gives an empty store.
+func NewFileValidatorStore(path string) (*FileValidatorStore, error) {
+	store := &FileValidatorStore{path: path, validators: make(map[string]Validators)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &store.validators); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+func (s *FileValidatorStore) Get(url string) (Validators, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	validators, ok := s.validators[url]
+	return validators, ok
+}
+
+func (s *FileValidatorStore) Put(url string, validators Validators) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.validators[url] = validators
+}
+
+// Save writes the store back to its file, replacing it atomically.
+func (s *FileValidatorStore) Save() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return writeJSONFileAtomically(s.path, s.validators)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileValidatorStore_SavesAndLoads(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "validators.json")
+	store, err := NewFileValidatorStore(path)
+	require.NoError(t, err)
+	_, ok := store.Get("https://example.com/")
+	assert.False(t, ok, "a missing file gives an empty store")
+
+	validators := Validators{
+		ETag:         `"abc"`,
+		LastModified: "Mon, 01 Jan 2024 00:00:00 GMT",
+		ContentHash:  ContentHash("Beans"),
+		Links:        []string{"https://example.com/beans"},
+		FetchedAt:    time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	store.Put("https://example.com/", validators)
+	require.NoError(t, store.Save())
+
+	reloaded, err := NewFileValidatorStore(path)
+	require.NoError(t, err)
+	loaded, ok := reloaded.Get("https://example.com/")
+	require.True(t, ok)
+	assert.Equal(t, validators, loaded)
+}
+
+func TestValidatorsFromResult(t *testing.T) {
+	t.Parallel()
+	result := &FetchResult{
+		Header: http.Header{"Etag": {`"abc"`}, "Last-Modified": {"Mon, 01 Jan 2024 00:00:00 GMT"}},
+		Body:   "Beans",
+	}
+	validators := ValidatorsFromResult(result, []string{"https://example.com/toast"})
+	assert.Equal(t, `"abc"`, validators.ETag)
+	assert.Equal(t, "Mon, 01 Jan 2024 00:00:00 GMT", validators.LastModified)
+	assert.Equal(t, ContentHash("Beans"), validators.ContentHash)
+	assert.NotEqual(t, ContentHash("Toast"), validators.ContentHash)
+	assert.Equal(t, []string{"https://example.com/toast"}, validators.Links)
+	assert.True(t, validators.conditional())
+	assert.False(t, Validators{ContentHash: "abc"}.conditional())
+}